@@ -0,0 +1,64 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+func (p *SyncPolicy) GetConditions() kmapi.Conditions {
+	return p.Status.Conditions
+}
+
+func (p *SyncPolicy) SetConditions(conditions kmapi.Conditions) {
+	p.Status.Conditions = conditions
+}
+
+// Selects returns true if obj of the given kind is a source of this policy.
+// A policy that sets neither a source name nor a source selector selects nothing.
+func (p *SyncPolicy) Selects(kind SourceKind, obj metav1.Object) (bool, error) {
+	src := p.Spec.Source
+	if src.Kind != kind || src.Namespace != obj.GetNamespace() {
+		return false, nil
+	}
+	if src.Name != "" && src.Name != obj.GetName() {
+		return false, nil
+	}
+	if src.Selector != nil {
+		sel, err := metav1.LabelSelectorAsSelector(src.Selector)
+		if err != nil {
+			return false, err
+		}
+		return sel.Matches(labels.Set(obj.GetLabels())), nil
+	}
+	return src.Name != "", nil
+}
+
+// NamespaceSelectors returns the target namespace selectors in their string form.
+func (p *SyncPolicy) NamespaceSelectors() ([]string, error) {
+	out := make([]string, 0, len(p.Spec.Target.NamespaceSelectors))
+	for i := range p.Spec.Target.NamespaceSelectors {
+		sel, err := metav1.LabelSelectorAsSelector(&p.Spec.Target.NamespaceSelectors[i])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sel.String())
+	}
+	return out, nil
+}
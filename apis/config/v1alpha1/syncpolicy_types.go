@@ -0,0 +1,184 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+const (
+	ResourceKindSyncPolicy = "SyncPolicy"
+	ResourceSyncPolicy     = "syncpolicy"
+	ResourceSyncPolicies   = "syncpolicies"
+)
+
+// SyncPolicy describes which ConfigMaps or Secrets are copied into other
+// namespaces and clusters. It is an alternative to setting the
+// kubed.appscode.com/sync and kubed.appscode.com/sync-contexts annotations
+// on the source object itself.
+//
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=syncpolicies,singular=syncpolicy,scope=Cluster,categories={config,kubeops,appscode}
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Kind",type="string",JSONPath=".spec.source.kind"
+// +kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".spec.source.namespace"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type SyncPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SyncPolicySpec   `json:"spec,omitempty"`
+	Status SyncPolicyStatus `json:"status,omitempty"`
+}
+
+// SyncPolicySpec is the spec for a SyncPolicy
+type SyncPolicySpec struct {
+	// Source selects the ConfigMaps or Secrets that are synced by this policy.
+	Source SyncSource `json:"source"`
+
+	// Target specifies where the selected sources are synced into.
+	// +optional
+	Target SyncTarget `json:"target,omitempty"`
+
+	// Keys filters and renames the data keys copied from the selected sources.
+	// +optional
+	Keys KeyFilter `json:"keys,omitempty"`
+
+	// Transform references a Starlark script that customises the copies per target.
+	// +optional
+	Transform *TransformRef `json:"transform,omitempty"`
+
+	// Template renders the values of ConfigMap sources as Go templates for each target.
+	// +optional
+	Template bool `json:"template,omitempty"`
+}
+
+// TransformRef references a Starlark script stored in a ConfigMap in the namespace of the sources.
+type TransformRef struct {
+	// Name of the ConfigMap.
+	Name string `json:"name"`
+
+	// Key of the script in the ConfigMap. Defaults to transform.star.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// KeyFilter selects data keys by glob patterns, eg, ca.crt or *.pem, and renames them.
+// A key is copied if it matches any include pattern, or no include patterns
+// are given, and it does not match any exclude pattern.
+type KeyFilter struct {
+	// Include lists the patterns of the keys that are copied.
+	// +optional
+	Include []string `json:"include,omitempty"`
+
+	// Exclude lists the patterns of the keys that are never copied.
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Rename maps the keys of the source to the keys of the copies.
+	// Keys are renamed after they are filtered.
+	// +optional
+	Rename map[string]string `json:"rename,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=ConfigMap;Secret
+type SourceKind string
+
+const (
+	SourceKindConfigMap SourceKind = "ConfigMap"
+	SourceKindSecret    SourceKind = "Secret"
+)
+
+// SyncSource selects the source objects of a SyncPolicy.
+// Exactly one of Name or Selector should be set.
+type SyncSource struct {
+	Kind SourceKind `json:"kind"`
+
+	// Namespace of the source objects.
+	Namespace string `json:"namespace"`
+
+	// Name of the source object.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Selector is a label query over source objects in Namespace.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// SyncTarget describes the namespaces and clusters a source is synced into.
+type SyncTarget struct {
+	// Name of the copies. Defaults to the name of the source.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// NamespaceSelectors select the namespaces of the source cluster.
+	// A namespace is selected if it matches any of the selectors.
+	// An empty selector matches all namespaces.
+	// +optional
+	NamespaceSelectors []metav1.LabelSelector `json:"namespaceSelectors,omitempty"`
+
+	// Contexts are the names of the remote cluster contexts the source is synced into.
+	// +optional
+	Contexts []string `json:"contexts,omitempty"`
+
+	// ConflictPolicy decides what happens to an existing object in a target namespace
+	// that is not a copy. Defaults to the conflict policy of the operator.
+	// +optional
+	ConflictPolicy ConflictPolicy `json:"conflictPolicy,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=overwrite;skip;adopt-if-labelled
+type ConflictPolicy string
+
+const (
+	// ConflictPolicyOverwrite replaces existing objects with the copy
+	ConflictPolicyOverwrite ConflictPolicy = "overwrite"
+	// ConflictPolicySkip leaves existing objects alone
+	ConflictPolicySkip ConflictPolicy = "skip"
+	// ConflictPolicyAdoptIfLabelled replaces existing objects only if they are labelled kubed.appscode.com/adopt=true
+	ConflictPolicyAdoptIfLabelled ConflictPolicy = "adopt-if-labelled"
+)
+
+// SyncPolicyStatus is the status for a SyncPolicy
+type SyncPolicyStatus struct {
+	// ObservedGeneration is the most recent generation observed for this resource.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Sources are the objects currently selected by this policy.
+	// +optional
+	Sources []kmapi.ObjectReference `json:"sources,omitempty"`
+
+	// +optional
+	Conditions []kmapi.Condition `json:"conditions,omitempty"`
+}
+
+// SyncPolicyList is a list of SyncPolicies
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+type SyncPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []SyncPolicy `json:"items"`
+}
@@ -0,0 +1,58 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// SyncStatus records where a source ConfigMap or Secret has been synced into.
+type SyncStatus struct {
+	// ResourceVersion of the source object observed by the last sync.
+	// +optional
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+
+	// Targets are the namespaces and contexts the source is synced into.
+	// +optional
+	Targets []TargetStatus `json:"targets,omitempty"`
+}
+
+type TargetPhase string
+
+const (
+	TargetPhaseSynced TargetPhase = "Synced"
+	TargetPhaseFailed TargetPhase = "Failed"
+	// TargetPhaseSkipped means an object that is not a copy exists in the target and was left alone
+	TargetPhaseSkipped TargetPhase = "Skipped"
+)
+
+// TargetStatus is the result of the last sync into a single target.
+type TargetStatus struct {
+	// Context is the name of the remote cluster context. Empty for the source cluster.
+	// +optional
+	Context string `json:"context,omitempty"`
+
+	// Namespace of the copy.
+	Namespace string `json:"namespace"`
+
+	Phase TargetPhase `json:"phase"`
+
+	// ResourceVersion of the source object last synced into this target.
+	// +optional
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+
+	// LastError is the error returned by the last failed sync into this target,
+	// or the reason the target was skipped.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
@@ -0,0 +1,82 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ResourceKindClusterContext = "ClusterContext"
+	ResourceClusterContext     = "clustercontext"
+	ResourceClusterContexts    = "clustercontexts"
+)
+
+// ClusterContext is a read-only view of a remote cluster that sources can be synced into, loaded
+// from the kubeconfig file or from a cluster Secret. ClusterContexts are computed by Config Syncer
+// and are not stored in etcd.
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterContext struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterContextSpec   `json:"spec,omitempty"`
+	Status ClusterContextStatus `json:"status,omitempty"`
+}
+
+// ClusterContextSpec describes how a remote cluster is reached.
+type ClusterContextSpec struct {
+	// Cluster is the name of the cluster in the kubeconfig.
+	Cluster string `json:"cluster"`
+
+	// Address of the API server of the cluster.
+	Address string `json:"address"`
+
+	// Namespace copies are synced into. If empty, the namespace of the source is used.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Secret is the namespace/name of the cluster Secret that registered the context.
+	// Empty for contexts of the kubeconfig file.
+	// +optional
+	Secret string `json:"secret,omitempty"`
+}
+
+// ClusterContextStatus is the health of a remote cluster as seen by the health probes.
+type ClusterContextStatus struct {
+	// Healthy is false while the context is skipped after repeated failed probes.
+	Healthy bool `json:"healthy"`
+
+	// ConsecutiveFailures is the number of failed probes since the last successful one.
+	// +optional
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+
+	// LastError is the error of the last failed probe.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// ClusterContextList is a list of ClusterContexts
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterContextList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ClusterContext `json:"items"`
+}
@@ -0,0 +1,105 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	configapi "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ResourceKindSyncedObject = "SyncedObject"
+	ResourceSyncedObject     = "syncedobject"
+	ResourceSyncedObjects    = "syncedobjects"
+)
+
+// SyncedObject is a read-only view of a ConfigMap, Secret or other resource that is synced via
+// annotations or SyncPolicies. It lives in the namespace of the source and is named
+// <source name>.<lowercase source kind>. SyncedObjects are computed by Config Syncer and are not
+// stored in etcd.
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type SyncedObject struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SyncedObjectSpec   `json:"spec,omitempty"`
+	Status SyncedObjectStatus `json:"status,omitempty"`
+}
+
+// SyncedObjectSpec describes where a source should be synced into.
+type SyncedObjectSpec struct {
+	// Source is the synced object in the same namespace.
+	Source SourceReference `json:"source"`
+
+	// TargetName is the name of the copies.
+	TargetName string `json:"targetName"`
+
+	// Namespaces of the source cluster the source should be synced into.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Contexts of remote clusters the source should be synced into.
+	// +optional
+	Contexts []string `json:"contexts,omitempty"`
+}
+
+// SourceReference references a source in the namespace of the SyncedObject.
+type SourceReference struct {
+	// APIGroup of the source. Empty for the core group.
+	// +optional
+	APIGroup string `json:"apiGroup,omitempty"`
+
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+
+	// ResourceVersion of the source.
+	// +optional
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// SyncedObjectPhase summarises the targets of a source.
+type SyncedObjectPhase string
+
+const (
+	// SyncedObjectPhaseSynced means the current version of the source was synced into every target, or the target was skipped.
+	SyncedObjectPhaseSynced SyncedObjectPhase = "Synced"
+	// SyncedObjectPhasePending means some targets were not synced yet, or hold an older version of the source.
+	SyncedObjectPhasePending SyncedObjectPhase = "Pending"
+	// SyncedObjectPhaseFailed means the last sync into some target failed.
+	SyncedObjectPhaseFailed SyncedObjectPhase = "Failed"
+)
+
+// SyncedObjectStatus is the observed state of the copies of a source.
+type SyncedObjectStatus struct {
+	Phase SyncedObjectPhase `json:"phase"`
+
+	// Targets is the status last recorded for each target.
+	// +optional
+	Targets []configapi.TargetStatus `json:"targets,omitempty"`
+}
+
+// SyncedObjectList is a list of SyncedObjects
+//
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type SyncedObjectList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []SyncedObject `json:"items"`
+}
@@ -35,6 +35,7 @@ func NewCmdConfigSyncer(version string) *cobra.Command {
 
 	stopCh := genericapiserver.SetupSignalHandler()
 	cmd.AddCommand(NewCmdRun(os.Stdout, os.Stderr, stopCh))
+	cmd.AddCommand(NewCmdStatus(os.Stdout, os.Stderr))
 	cmd.AddCommand(v.NewCmdVersion())
 
 	return cmd
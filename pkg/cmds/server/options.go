@@ -19,33 +19,78 @@ package server
 import (
 	"time"
 
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
 	"kubeops.dev/config-syncer/pkg/operator"
+	"kubeops.dev/config-syncer/pkg/syncer"
 
 	"github.com/spf13/pflag"
+	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	componentbaseconfig "k8s.io/component-base/config"
+	componentbaseoptions "k8s.io/component-base/config/options"
+	"kmodules.xyz/client-go/meta"
 )
 
 type OperatorOptions struct {
-	ClusterName           string
-	ConfigSourceNamespace string
-	KubeConfigFile        string
-
-	QPS          float32
-	Burst        int
-	ResyncPeriod time.Duration
+	ClusterName            string
+	ConfigSourceNamespace  string
+	KubeConfigFile         string
+	ClusterSecretNamespace string
+	Resources              []string
+
+	QPS            float32
+	Burst          int
+	ResyncPeriod   time.Duration
+	MaxNumRequeues int
+	NumThreads     int
+
+	HealthCheckInterval time.Duration
+	FailureThreshold    int
+	DryRun              bool
+	ConflictPolicy      string
+	GCInterval          time.Duration
+	GCDryRun            bool
+	AuthorizeSyncs      bool
+	RequesterKeySecret  string
+	OperatorPolicyFile  string
+
+	LeaderElection componentbaseconfig.LeaderElectionConfiguration
 }
 
 func NewOperatorOptions() *OperatorOptions {
 	return &OperatorOptions{
-		ClusterName:           "",
-		ConfigSourceNamespace: "",
-		KubeConfigFile:        "",
+		ClusterName:            "",
+		ConfigSourceNamespace:  "",
+		KubeConfigFile:         "",
+		ClusterSecretNamespace: meta.PodNamespace(),
 		// ref: https://github.com/kubernetes/ingress-nginx/blob/e4d53786e771cc6bdd55f180674b79f5b692e552/pkg/ingress/controller/launch.go#L252-L259
 		// High enough QPS to fit all expected use cases. QPS=0 is not set here, because client code is overriding it.
 		QPS: 1e6,
 		// High enough Burst to fit all expected use cases. Burst=0 is not set here, because client code is overriding it.
-		Burst:        1e6,
-		ResyncPeriod: 10 * time.Minute,
+		Burst:          1e6,
+		ResyncPeriod:   10 * time.Minute,
+		MaxNumRequeues: 5,
+		NumThreads:     2,
+
+		HealthCheckInterval: 30 * time.Second,
+		FailureThreshold:    3,
+		ConflictPolicy:      string(api.ConflictPolicyOverwrite),
+		GCInterval:          time.Hour,
+		GCDryRun:            true,
+		RequesterKeySecret:  "config-syncer-requester-key",
+
+		LeaderElection: componentbaseconfig.LeaderElectionConfiguration{
+			LeaderElect:       false,
+			LeaseDuration:     metav1.Duration{Duration: 15 * time.Second},
+			RenewDeadline:     metav1.Duration{Duration: 10 * time.Second},
+			RetryPeriod:       metav1.Duration{Duration: 2 * time.Second},
+			ResourceLock:      resourcelock.LeasesResourceLock,
+			ResourceName:      "config-syncer",
+			ResourceNamespace: meta.PodNamespace(),
+		},
 	}
 }
 
@@ -53,10 +98,25 @@ func (s *OperatorOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.ClusterName, "cluster-name", s.ClusterName, "Name of cluster")
 	fs.StringVar(&s.ConfigSourceNamespace, "config-source-namespace", s.ConfigSourceNamespace, "Config source namespace")
 	fs.StringVar(&s.KubeConfigFile, "kubeconfig-file", s.KubeConfigFile, "kubeconfig file")
+	fs.StringVar(&s.ClusterSecretNamespace, "cluster-secret-namespace", s.ClusterSecretNamespace, "Namespace of the Secrets labelled "+syncer.ClusterSecretLabelKey+"="+syncer.ClusterSecretLabelValue+" that register remote clusters. If empty, cluster Secrets are ignored")
+	fs.StringVar(&s.OperatorPolicyFile, "operator-policy-file", s.OperatorPolicyFile, "YAML file that lists the namespaces that may be sync sources, the namespaces that never receive copies and the maximum number of targets per source")
+	fs.StringSliceVar(&s.Resources, "resources", s.Resources, "Namespaced resources synced in addition to configmaps and secrets, as <group>/<version>/<resource> or <version>/<resource> for the core group, eg, rbac.authorization.k8s.io/v1/roles")
 
 	fs.Float32Var(&s.QPS, "qps", s.QPS, "The maximum QPS to the master from this client")
 	fs.IntVar(&s.Burst, "burst", s.Burst, "The maximum burst for throttle")
 	fs.DurationVar(&s.ResyncPeriod, "resync-period", s.ResyncPeriod, "If non-zero, will re-list this often. Otherwise, re-list will be delayed aslong as possible (until the upstream source closes the watch or times out.")
+	fs.IntVar(&s.MaxNumRequeues, "max-num-requeues", s.MaxNumRequeues, "Maximum number of times a failed sync is retried before the key is dropped from the queue")
+	fs.IntVar(&s.NumThreads, "num-threads", s.NumThreads, "Number of worker threads per queue")
+	fs.BoolVar(&s.DryRun, "dry-run", s.DryRun, "If true, creates, updates and deletes are only sent to the API servers as dry runs and the planned changes are logged")
+	fs.StringVar(&s.ConflictPolicy, "conflict-policy", s.ConflictPolicy, "What happens to an existing object in a target namespace that is not a copy, one of overwrite, skip or adopt-if-labelled. Can be overridden per source")
+	fs.DurationVar(&s.GCInterval, "gc-interval", s.GCInterval, "How often copies whose source no longer exists or no longer selects them are deleted. If zero, orphaned copies are not collected. Requires --cluster-name")
+	fs.BoolVar(&s.GCDryRun, "gc-dry-run", s.GCDryRun, "If true, orphaned copies are only logged and counted, not deleted. Set to false to delete them")
+	fs.BoolVar(&s.AuthorizeSyncs, "authorize-syncs", s.AuthorizeSyncs, "If true, sources synced via annotations are only copied into namespaces where the user in their sync-requested-by annotation may create them")
+	fs.StringVar(&s.RequesterKeySecret, "requester-key-secret", s.RequesterKeySecret, "Secret in the namespace of the operator that holds the key signing sync-requested-by annotations. Created with a random key if it does not exist. Used with --authorize-syncs")
+	fs.DurationVar(&s.HealthCheckInterval, "context-health-check-interval", s.HealthCheckInterval, "How often the clusters of remote contexts are probed. If zero, contexts are not probed")
+	fs.IntVar(&s.FailureThreshold, "context-failure-threshold", s.FailureThreshold, "Number of consecutive failed probes after which a remote context is skipped until it recovers")
+
+	componentbaseoptions.BindLeaderElectionFlags(&s.LeaderElection, fs)
 }
 
 func (s *OperatorOptions) ApplyTo(cfg *operator.OperatorConfig) error {
@@ -65,15 +125,51 @@ func (s *OperatorOptions) ApplyTo(cfg *operator.OperatorConfig) error {
 	cfg.ClientConfig.QPS = s.QPS
 	cfg.ClientConfig.Burst = s.Burst
 	cfg.ResyncPeriod = s.ResyncPeriod
+	cfg.MaxNumRequeues = s.MaxNumRequeues
+	cfg.NumThreads = s.NumThreads
+	cfg.HealthCheckInterval = s.HealthCheckInterval
+	cfg.FailureThreshold = s.FailureThreshold
+	cfg.DryRun = s.DryRun
+	cfg.ConflictPolicy = api.ConflictPolicy(s.ConflictPolicy)
+	cfg.GCInterval = s.GCInterval
+	cfg.GCDryRun = s.GCDryRun
+	cfg.AuthorizeSyncs = s.AuthorizeSyncs
+	cfg.RequesterKeySecretNamespace = meta.PodNamespace()
+	cfg.RequesterKeySecretName = s.RequesterKeySecret
+	if err = syncer.ValidateConflictPolicy(cfg.ConflictPolicy); err != nil {
+		return err
+	}
+	cfg.LeaderElection = s.LeaderElection
 	cfg.Test = false
 
 	if cfg.KubeClient, err = kubernetes.NewForConfig(cfg.ClientConfig); err != nil {
 		return err
 	}
+	if cfg.DynamicClient, err = dynamic.NewForConfig(cfg.ClientConfig); err != nil {
+		return err
+	}
+	if cfg.CRDClient, err = crd_cs.NewForConfig(cfg.ClientConfig); err != nil {
+		return err
+	}
 
 	cfg.ClusterName = s.ClusterName
 	cfg.ConfigSourceNamespace = s.ConfigSourceNamespace
 	cfg.KubeConfigFile = s.KubeConfigFile
+	cfg.ClusterSecretNamespace = s.ClusterSecretNamespace
+	cfg.Policy = nil
+	if s.OperatorPolicyFile != "" {
+		if cfg.Policy, err = syncer.LoadOperatorPolicy(s.OperatorPolicyFile); err != nil {
+			return err
+		}
+	}
+	cfg.Resources = nil
+	for _, r := range s.Resources {
+		gvr, err := syncer.ParseGroupVersionResource(r)
+		if err != nil {
+			return err
+		}
+		cfg.Resources = append(cfg.Resources, gvr)
+	}
 
 	return nil
 }
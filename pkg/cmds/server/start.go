@@ -57,6 +57,8 @@ func NewConfigSyncerOptions(out, errOut io.Writer) *ConfigSyncerOptions {
 	}
 	o.RecommendedOptions.Etcd = nil
 	o.RecommendedOptions.Admission = nil
+	// the API server calls the webhook without credentials
+	o.RecommendedOptions.Authorization.WithAlwaysAllowPaths(server.ValidatingWebhookPath, server.MutatingWebhookPath)
 
 	return o
 }
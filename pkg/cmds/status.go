@@ -0,0 +1,49 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"io"
+
+	"kubeops.dev/config-syncer/pkg/cmds/status"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCmdStatus(out, errOut io.Writer) *cobra.Command {
+	o := status.NewStatusOptions(out, errOut)
+
+	cmd := &cobra.Command{
+		Use:               "status",
+		Short:             "Show synced objects and the state of their copies",
+		Long:              "Show every object carrying sync annotations, the namespaces and contexts it should be synced into, and whether its copies are synced, stale, missing or orphaned.",
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+
+	o.AddFlags(cmd.Flags())
+
+	return cmd
+}
@@ -0,0 +1,171 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"kmodules.xyz/client-go/discovery"
+	"sigs.k8s.io/yaml"
+)
+
+type StatusOptions struct {
+	ConfigFlags *genericclioptions.ConfigFlags
+
+	KubeConfigFile         string
+	ClusterSecretNamespace string
+	ConfigSourceNamespace  string
+	ClusterName            string
+	Resources              []string
+	OperatorPolicyFile     string
+	Output                 string
+
+	Out    io.Writer
+	ErrOut io.Writer
+}
+
+func NewStatusOptions(out, errOut io.Writer) *StatusOptions {
+	return &StatusOptions{
+		ConfigFlags:            genericclioptions.NewConfigFlags(true),
+		ClusterSecretNamespace: metav1.NamespaceSystem,
+		Output:                 "table",
+		Out:                    out,
+		ErrOut:                 errOut,
+	}
+}
+
+func (o *StatusOptions) AddFlags(fs *pflag.FlagSet) {
+	o.ConfigFlags.AddFlags(fs)
+	fs.StringVar(&o.KubeConfigFile, "kubeconfig-file", o.KubeConfigFile, "kubeconfig file with the contexts of remote clusters, as passed to config-syncer run")
+	fs.StringVar(&o.ClusterSecretNamespace, "cluster-secret-namespace", o.ClusterSecretNamespace, "Namespace of the Secrets labelled "+syncer.ClusterSecretLabelKey+"="+syncer.ClusterSecretLabelValue+" that register remote clusters, as passed to config-syncer run. If empty, cluster Secrets are ignored")
+	fs.StringVar(&o.ConfigSourceNamespace, "config-source-namespace", o.ConfigSourceNamespace, "Config source namespace, as passed to config-syncer run. If set, only sources in this namespace are shown")
+	fs.StringVar(&o.ClusterName, "cluster-name", o.ClusterName, "Name of the cluster as passed to config-syncer run. Only copies made from a cluster with this name are considered")
+	fs.StringSliceVar(&o.Resources, "resources", o.Resources, "Namespaced resources synced in addition to configmaps and secrets, as passed to config-syncer run")
+	fs.StringVar(&o.OperatorPolicyFile, "operator-policy-file", o.OperatorPolicyFile, "Operator policy file, as passed to config-syncer run")
+	fs.StringVarP(&o.Output, "output", "o", o.Output, "Output format, one of table, json or yaml")
+}
+
+func (o *StatusOptions) Validate() error {
+	switch o.Output {
+	case "table", "json", "yaml":
+		return nil
+	default:
+		return errors.Errorf("unknown output format %q, must be one of table, json or yaml", o.Output)
+	}
+}
+
+func (o *StatusOptions) Run() error {
+	cfg, err := o.ConfigFlags.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	kc, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	dc, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	resources := syncer.DefaultResources()
+	mapper := discovery.NewResourceMapper(discovery.NewRestMapper(kc.Discovery()))
+	for _, v := range o.Resources {
+		gvr, err := syncer.ParseGroupVersionResource(v)
+		if err != nil {
+			return err
+		}
+		gvk, err := mapper.GVK(gvr)
+		if err != nil {
+			return errors.Wrapf(err, "failed to detect kind of resource %s", gvr)
+		}
+		resources = append(resources, syncer.NewResource(gvr, gvk.Kind))
+	}
+
+	contexts, err := syncer.LoadRemoteContexts(kc, o.KubeConfigFile, o.ClusterSecretNamespace)
+	if err != nil {
+		return err
+	}
+	if len(contexts) > 0 && o.ClusterName == "" {
+		_, _ = fmt.Fprintln(o.ErrOut, "Warning: without --cluster-name, copies made by other clusters that kept the default name can not be told apart from copies made by this cluster")
+	}
+	var policy *syncer.OperatorPolicy
+	if o.OperatorPolicyFile != "" {
+		if policy, err = syncer.LoadOperatorPolicy(o.OperatorPolicyFile); err != nil {
+			return err
+		}
+	}
+	policies, err := listSyncPolicies(context.TODO(), dc)
+	if err != nil {
+		return err
+	}
+
+	namespace := ""
+	if o.ConfigFlags.Namespace != nil {
+		namespace = *o.ConfigFlags.Namespace
+	}
+	if o.ConfigSourceNamespace != "" {
+		// the operator only syncs sources in the config source namespace
+		if namespace != "" && namespace != o.ConfigSourceNamespace {
+			return errors.Errorf("namespace %s is not the config source namespace %s", namespace, o.ConfigSourceNamespace)
+		}
+		namespace = o.ConfigSourceNamespace
+	}
+	c := &collector{
+		kc:          kc,
+		dc:          dc,
+		contexts:    contexts,
+		clusterName: o.ClusterName,
+		policies:    policies,
+		policy:      policy,
+		errOut:      o.ErrOut,
+	}
+	sources, err := c.collect(context.TODO(), resources, namespace)
+	if err != nil {
+		return err
+	}
+
+	switch o.Output {
+	case "json":
+		data, err := json.MarshalIndent(sources, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(o.Out, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(sources)
+		if err != nil {
+			return err
+		}
+		_, err = o.Out.Write(data)
+		return err
+	default:
+		return printTable(o.Out, sources)
+	}
+}
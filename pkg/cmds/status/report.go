@@ -0,0 +1,434 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CopyState is the state of a copy, or of a target that should have a copy.
+type CopyState string
+
+const (
+	// CopyStateSynced means the copy was made from the current version of its source.
+	CopyStateSynced CopyState = "Synced"
+	// CopyStateStale means the copy was made from an older version of its source.
+	CopyStateStale CopyState = "Stale"
+	// CopyStateMissing means the target should have a copy, but has none.
+	CopyStateMissing CopyState = "Missing"
+	// CopyStateOrphaned means the copy is not wanted by its source, or its source is gone.
+	CopyStateOrphaned CopyState = "Orphaned"
+	// CopyStateUnmanaged means the copy opted out of updates by Config Syncer.
+	CopyStateUnmanaged CopyState = "Unmanaged"
+	// CopyStateUnknown means the copies in the target context could not be checked.
+	CopyStateUnknown CopyState = "Unknown"
+)
+
+// Source is a synced object along with its targets and copies.
+type Source struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// ResourceVersion of the source. Empty if the source does not exist anymore.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// TargetName is the name of the copies.
+	TargetName string `json:"targetName,omitempty"`
+	// Namespaces of the source cluster the source should be synced into.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Contexts of remote clusters the source should be synced into.
+	Contexts []string `json:"contexts,omitempty"`
+	// Refused is why the operator does not sync the source, if it refuses to.
+	Refused string `json:"refused,omitempty"`
+	Copies  []Copy `json:"copies,omitempty"`
+}
+
+// Copy is a copy of a source, or a target that is missing its copy.
+type Copy struct {
+	Context   string    `json:"context,omitempty"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	State     CopyState `json:"state"`
+	// ResourceVersion of the source the copy was made from, read from its origin annotation.
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type collector struct {
+	kc          kubernetes.Interface
+	dc          dynamic.Interface
+	contexts    []syncer.RemoteContext
+	clusterName string
+	policies    []*api.SyncPolicy
+	policy      *syncer.OperatorPolicy
+	errOut      io.Writer
+}
+
+// listSyncPolicies returns the SyncPolicies of the cluster, or none if their CRD is not installed.
+func listSyncPolicies(ctx context.Context, dc dynamic.Interface) ([]*api.SyncPolicy, error) {
+	list, err := dc.Resource(api.SchemeGroupVersion.WithResource(api.ResourceSyncPolicies)).List(ctx, metav1.ListOptions{})
+	if kerr.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	out := make([]*api.SyncPolicy, 0, len(list.Items))
+	for _, item := range list.Items {
+		var policy api.SyncPolicy
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.UnstructuredContent(), &policy); err != nil {
+			return nil, err
+		}
+		out = append(out, &policy)
+	}
+	return out, nil
+}
+
+// copySet holds the copies of a resource found in a cluster, by origin namespace/name.
+type copySet map[string][]unstructured.Unstructured
+
+func (c *collector) collect(ctx context.Context, resources []syncer.Resource, namespace string) ([]Source, error) {
+	nsList, err := c.kc.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Source
+	for _, r := range resources {
+		var objs *unstructured.UnstructuredList
+		if objs, err = c.dc.Resource(r.GroupVersionResource).Namespace(namespace).List(ctx, metav1.ListOptions{}); err != nil {
+			return nil, err
+		}
+		local, err := c.listCopies(ctx, c.dc, r, namespace)
+		if err != nil {
+			return nil, err
+		}
+		remote := map[string]copySet{} // by context name
+		for _, rc := range c.uniqueContexts() {
+			if remote[rc.Name], err = c.listCopies(ctx, rc.Dynamic, r, namespace); err != nil {
+				_, _ = fmt.Fprintf(c.errOut, "failed to list %s in context %s: %v\n", r.Resource, rc.Name, err)
+				remote[rc.Name] = nil
+			}
+		}
+
+		seen := sets.NewString()
+		for i := range objs.Items {
+			src := &objs.Items[i]
+			key := src.GetNamespace() + "/" + src.GetName()
+			if _, ok := src.GetLabels()[syncer.StatusKindLabelKey]; ok {
+				continue
+			}
+			if _, ok := src.GetLabels()[syncer.OriginNameLabelKey]; ok {
+				// copies keep the sync annotations of their previous version
+				continue
+			}
+			opts := syncer.MergeSyncOptions(src, syncer.SelectSyncPolicies(c.policies, r.SourceKind(), src))
+			if len(opts.NamespaceSelectors) == 0 && opts.Contexts.Len() == 0 && len(local[key]) == 0 && !hasRemoteCopies(remote, key) {
+				continue
+			}
+			seen.Insert(key)
+			s, err := c.source(ctx, r, src, opts, nsList.Items, local[key], remote)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, *s)
+		}
+
+		// copies whose source is gone
+		for _, key := range orphanKeys(local, remote).Difference(seen).List() {
+			src := &unstructured.Unstructured{}
+			ns, name, _ := strings.Cut(key, "/")
+			src.SetNamespace(ns)
+			src.SetName(name)
+			s, err := c.source(ctx, r, src, syncer.SyncOptions{}, nil, local[key], remote)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, *s)
+		}
+	}
+	return out, nil
+}
+
+func (c *collector) source(ctx context.Context, r syncer.Resource, src *unstructured.Unstructured, opts syncer.SyncOptions, namespaces []core.Namespace, local []unstructured.Unstructured, remote map[string]copySet) (*Source, error) {
+	key := src.GetNamespace() + "/" + src.GetName()
+	if src.GetDeletionTimestamp() != nil {
+		// the copies of a terminating source are pruned
+		opts = syncer.SyncOptions{TargetName: opts.TargetName}
+	}
+	refused := ""
+	if !c.policy.AllowsSource(src.GetNamespace()) {
+		// the copies made before the namespace was disallowed are pruned
+		if len(opts.NamespaceSelectors) > 0 || opts.Contexts.Len() > 0 {
+			refused = fmt.Sprintf("namespace %s may not be a sync source", src.GetNamespace())
+		}
+		opts = syncer.SyncOptions{TargetName: opts.TargetName}
+	}
+	s := &Source{
+		Kind:            r.Kind,
+		Namespace:       src.GetNamespace(),
+		Name:            src.GetName(),
+		ResourceVersion: src.GetResourceVersion(),
+		TargetName:      opts.TargetName,
+		Contexts:        opts.Contexts.List(),
+	}
+	if s.TargetName == "" {
+		s.TargetName = src.GetName()
+	}
+
+	// targets in the source cluster
+	targets := sets.NewString()
+	if len(opts.NamespaceSelectors) > 0 {
+		for i := range namespaces {
+			ns := &namespaces[i]
+			if ns.Name == src.GetNamespace() && s.TargetName == src.GetName() {
+				continue
+			}
+			matched, err := syncer.SelectorsMatch(opts.NamespaceSelectors, ns.Labels)
+			if err != nil {
+				return nil, err
+			}
+			if matched && !syncer.Excludes(ns, r.Kind, src) && !c.policy.DeniesTarget(ns.Name) {
+				targets.Insert(ns.Name)
+			}
+		}
+	}
+	s.Namespaces = targets.List()
+	if n := targets.Len() + opts.Contexts.Len(); refused == "" && c.policy.ExceedsFanOut(n) {
+		// the operator leaves the existing copies alone
+		refused = fmt.Sprintf("source selects %d targets, at most %d are allowed", n, c.policy.MaxFanOut)
+	}
+	s.Refused = refused
+	found := sets.NewString()
+	for i := range local {
+		cp := &local[i]
+		wanted := targets.Has(cp.GetNamespace()) && cp.GetName() == s.TargetName
+		if wanted {
+			found.Insert(cp.GetNamespace())
+		}
+		s.Copies = append(s.Copies, copyOf("", cp, src, wanted))
+	}
+	for _, ns := range targets.Difference(found).List() {
+		s.Copies = append(s.Copies, Copy{Namespace: ns, Name: s.TargetName, State: CopyStateMissing})
+	}
+
+	// targets in remote clusters
+	contexts := map[string]syncer.RemoteContext{}
+	for _, rc := range c.contexts {
+		contexts[rc.Name] = rc
+	}
+	wanted := map[string]sets.String{} // target namespaces by address
+	for _, name := range s.Contexts {
+		rc, ok := contexts[name]
+		ns := rc.Namespace
+		if ns == "" {
+			ns = src.GetNamespace()
+		}
+		if c.policy.DeniesTarget(ns) {
+			continue
+		}
+		if !ok || remote[c.contextFor(rc.Address).Name] == nil {
+			s.Copies = append(s.Copies, Copy{Context: name, Namespace: ns, Name: s.TargetName, State: CopyStateUnknown})
+			continue
+		}
+		if excluded, err := c.contextExcludes(ctx, rc, ns, r.Kind, src); err != nil {
+			_, _ = fmt.Fprintf(c.errOut, "failed to get namespace %s in context %s: %v\n", ns, name, err)
+			s.Copies = append(s.Copies, Copy{Context: name, Namespace: ns, Name: s.TargetName, State: CopyStateUnknown})
+			continue
+		} else if excluded {
+			continue
+		}
+		if wanted[rc.Address] == nil {
+			wanted[rc.Address] = sets.NewString()
+		}
+		wanted[rc.Address].Insert(ns)
+	}
+	for _, rc := range c.uniqueContexts() {
+		copies := remote[rc.Name]
+		found := sets.NewString()
+		for i := range copies[key] {
+			cp := &copies[key][i]
+			ok := wanted[rc.Address].Has(cp.GetNamespace()) && cp.GetName() == s.TargetName
+			if ok {
+				found.Insert(cp.GetNamespace())
+			}
+			s.Copies = append(s.Copies, copyOf(rc.Name, cp, src, ok))
+		}
+		for _, ns := range wanted[rc.Address].Difference(found).List() {
+			s.Copies = append(s.Copies, Copy{Context: rc.Name, Namespace: ns, Name: s.TargetName, State: CopyStateMissing})
+		}
+	}
+
+	sort.SliceStable(s.Copies, func(i, j int) bool {
+		if s.Copies[i].Context != s.Copies[j].Context {
+			return s.Copies[i].Context < s.Copies[j].Context
+		}
+		return s.Copies[i].Namespace < s.Copies[j].Namespace
+	})
+	return s, nil
+}
+
+func copyOf(ctx string, cp, src *unstructured.Unstructured, wanted bool) Copy {
+	out := Copy{
+		Context:   ctx,
+		Namespace: cp.GetNamespace(),
+		Name:      cp.GetName(),
+	}
+	var ref core.ObjectReference
+	if v, ok := cp.GetAnnotations()[syncer.ConfigOriginKey]; ok {
+		if err := json.Unmarshal([]byte(v), &ref); err == nil {
+			out.ResourceVersion = ref.ResourceVersion
+		}
+	}
+	switch {
+	case cp.GetAnnotations()[syncer.UnmanagedKey] == "true":
+		out.State = CopyStateUnmanaged
+	case !wanted:
+		out.State = CopyStateOrphaned
+	case out.ResourceVersion != src.GetResourceVersion():
+		out.State = CopyStateStale
+	default:
+		out.State = CopyStateSynced
+	}
+	return out
+}
+
+// contextExcludes returns true if the namespace of a remote context opted out of syncs of src.
+func (c *collector) contextExcludes(ctx context.Context, rc syncer.RemoteContext, namespace, kind string, src metav1.Object) (bool, error) {
+	ns, err := rc.Client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return syncer.Excludes(ns, kind, src), nil
+}
+
+// listCopies returns the copies of a resource made from this cluster, by origin namespace/name.
+// If namespace is set, only copies of sources in that namespace are returned.
+func (c *collector) listCopies(ctx context.Context, dc dynamic.Interface, r syncer.Resource, namespace string) (copySet, error) {
+	sel := labels.NewSelector()
+	req, err := labels.NewRequirement(syncer.OriginNameLabelKey, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+	sel = sel.Add(*req)
+	if namespace != "" {
+		if req, err = labels.NewRequirement(syncer.OriginNamespaceLabelKey, selection.Equals, []string{namespace}); err != nil {
+			return nil, err
+		}
+		sel = sel.Add(*req)
+	}
+	// like the operator, tell copies made from this cluster apart by the cluster name, even if it is empty
+	if req, err = labels.NewRequirement(syncer.OriginClusterLabelKey, selection.Equals, []string{c.clusterName}); err != nil {
+		return nil, err
+	}
+	sel = sel.Add(*req)
+
+	list, err := dc.Resource(r.GroupVersionResource).Namespace(core.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return nil, err
+	}
+	out := copySet{}
+	for _, item := range list.Items {
+		lbls := item.GetLabels()
+		key := lbls[syncer.OriginNamespaceLabelKey] + "/" + lbls[syncer.OriginNameLabelKey]
+		out[key] = append(out[key], item)
+	}
+	return out, nil
+}
+
+// uniqueContexts returns one context per remote cluster, so that copies are listed once per cluster.
+func (c *collector) uniqueContexts() []syncer.RemoteContext {
+	seen := sets.NewString()
+	var out []syncer.RemoteContext
+	for _, rc := range c.contexts {
+		if !seen.Has(rc.Address) {
+			seen.Insert(rc.Address)
+			out = append(out, rc)
+		}
+	}
+	return out
+}
+
+// contextFor returns the context copies of the cluster at address are listed with.
+func (c *collector) contextFor(address string) syncer.RemoteContext {
+	for _, rc := range c.uniqueContexts() {
+		if rc.Address == address {
+			return rc
+		}
+	}
+	return syncer.RemoteContext{}
+}
+
+func hasRemoteCopies(remote map[string]copySet, key string) bool {
+	for _, copies := range remote {
+		if len(copies[key]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func orphanKeys(local copySet, remote map[string]copySet) sets.String {
+	keys := sets.StringKeySet(local)
+	for _, copies := range remote {
+		keys = keys.Union(sets.StringKeySet(copies))
+	}
+	return keys
+}
+
+func printTable(out io.Writer, sources []Source) error {
+	w := printers.GetNewTabWriter(out)
+	_, _ = fmt.Fprintln(w, "KIND\tSOURCE\tCONTEXT\tTARGET\tSTATE")
+	for _, s := range sources {
+		src := s.Namespace + "/" + s.Name
+		if s.ResourceVersion == "" {
+			src += " (deleted)"
+		} else if s.Refused != "" {
+			src += " (refused)"
+		}
+		if len(s.Copies) == 0 {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t-\t-\t-\n", s.Kind, src)
+		}
+		for _, cp := range s.Copies {
+			ctx := cp.Context
+			if ctx == "" {
+				ctx = "-"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%s\n", s.Kind, src, ctx, cp.Namespace, cp.Name, cp.State)
+		}
+	}
+	return w.Flush()
+}
@@ -30,6 +30,16 @@ import (
 const (
 	// Syncer Events
 	EventReasonOriginConflict = "OriginConflict"
+	EventReasonSynced         = "Synced"
+	EventReasonSyncFailed     = "SyncFailed"
+	EventReasonPruned         = "Pruned"
+	EventReasonSyncSkipped    = "SyncSkipped"
+	EventReasonSyncRefused    = "SyncRefused"
+	EventReasonDriftCorrected = "DriftCorrected"
+	EventReasonInvalidCluster = "InvalidCluster"
+
+	EventReasonContextUnhealthy = "ContextUnhealthy"
+	EventReasonContextRecovered = "ContextRecovered"
 )
 
 func NewEventRecorder(client kubernetes.Interface, component string) record.EventRecorder {
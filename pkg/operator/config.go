@@ -19,29 +19,58 @@ package operator
 import (
 	"time"
 
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
 	"kubeops.dev/config-syncer/pkg/eventer"
 	"kubeops.dev/config-syncer/pkg/syncer"
 
+	"github.com/pkg/errors"
+	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	componentbaseconfig "k8s.io/component-base/config"
+	"kmodules.xyz/client-go/apiextensions"
 	"kmodules.xyz/client-go/discovery"
 )
 
 type Config struct {
-	ClusterName           string
-	ConfigSourceNamespace string
-	KubeConfigFile        string
-
-	ResyncPeriod time.Duration
-	Test         bool
+	ClusterName            string
+	ConfigSourceNamespace  string
+	KubeConfigFile         string
+	ClusterSecretNamespace string
+	Resources              []schema.GroupVersionResource
+
+	MaxNumRequeues      int
+	NumThreads          int
+	ResyncPeriod        time.Duration
+	HealthCheckInterval time.Duration
+	FailureThreshold    int
+	DryRun              bool
+	ConflictPolicy      api.ConflictPolicy
+	GCInterval          time.Duration
+	GCDryRun            bool
+	AuthorizeSyncs      bool
+	Policy              *syncer.OperatorPolicy
+	LeaderElection      componentbaseconfig.LeaderElectionConfiguration
+	Test                bool
+
+	// Secret holding the key that signs the sync-requested-by annotation
+	RequesterKeySecretNamespace string
+	RequesterKeySecretName      string
 }
 
 type OperatorConfig struct {
 	Config
 
-	ClientConfig *rest.Config
-	KubeClient   kubernetes.Interface
+	ClientConfig  *rest.Config
+	KubeClient    kubernetes.Interface
+	DynamicClient dynamic.Interface
+	CRDClient     crd_cs.Interface
 }
 
 func NewOperatorConfig(clientConfig *rest.Config) *OperatorConfig {
@@ -55,14 +84,50 @@ func (c *OperatorConfig) New() (*Operator, error) {
 		return nil, err
 	}
 
+	crds := []*apiextensions.CustomResourceDefinition{
+		api.SyncPolicy{}.CustomResourceDefinition(),
+	}
+	if err := apiextensions.RegisterCRDs(c.CRDClient, crds); err != nil {
+		return nil, err
+	}
+
 	op := &Operator{
-		Config:       c.Config,
-		ClientConfig: c.ClientConfig,
-		KubeClient:   c.KubeClient,
+		Config:        c.Config,
+		ClientConfig:  c.ClientConfig,
+		KubeClient:    c.KubeClient,
+		DynamicClient: c.DynamicClient,
 	}
 
 	op.recorder = eventer.NewEventRecorder(op.KubeClient, "config-syncer")
-	op.configSyncer = syncer.New(op.KubeClient, op.recorder)
+	resources, err := c.syncedResources()
+	if err != nil {
+		return nil, err
+	}
+	var requesterKey []byte
+	if c.AuthorizeSyncs {
+		if requesterKey, err = syncer.LoadRequesterKey(op.KubeClient, c.RequesterKeySecretNamespace, c.RequesterKeySecretName); err != nil {
+			return nil, err
+		}
+	}
+	op.configSyncer = syncer.New(op.KubeClient, op.DynamicClient, op.recorder, syncer.Options{
+		Resources:           resources,
+		MaxNumRequeues:      c.MaxNumRequeues,
+		NumThreads:          c.NumThreads,
+		DryRun:              c.DryRun,
+		ConflictPolicy:      c.ConflictPolicy,
+		GCInterval:          c.GCInterval,
+		GCDryRun:            c.GCDryRun,
+		AuthorizeSyncs:      c.AuthorizeSyncs,
+		RequesterKey:        requesterKey,
+		Policy:              c.Policy,
+		HealthCheckInterval: c.HealthCheckInterval,
+		FailureThreshold:    c.FailureThreshold,
+	})
+	if c.AuthorizeSyncs {
+		if err := op.configSyncer.LoadRequesterWebhooks(); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := op.Configure(); err != nil {
 		return nil, err
@@ -70,6 +135,21 @@ func (c *OperatorConfig) New() (*Operator, error) {
 
 	// ---------------------------
 	op.kubeInformerFactory = informers.NewSharedInformerFactory(op.KubeClient, c.ResyncPeriod)
+	op.dynamicInformerFactory = dynamicinformer.NewDynamicSharedInformerFactory(op.DynamicClient, c.ResyncPeriod)
+	op.clusterInformerFactory = informers.NewSharedInformerFactoryWithOptions(
+		op.KubeClient,
+		c.ResyncPeriod,
+		informers.WithNamespace(c.ClusterSecretNamespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labels.SelectorFromSet(labels.Set{
+				syncer.ClusterSecretLabelKey: syncer.ClusterSecretLabelValue,
+			}).String()
+		}),
+	)
+	op.sourceInformerFactory = dynamicinformer.NewFilteredDynamicSharedInformerFactory(op.DynamicClient, c.ResyncPeriod, c.ConfigSourceNamespace, nil)
+	op.copyInformerFactory = dynamicinformer.NewFilteredDynamicSharedInformerFactory(op.DynamicClient, c.ResyncPeriod, metav1.NamespaceAll, func(options *metav1.ListOptions) {
+		options.LabelSelector = syncer.OriginNameLabelKey
+	})
 	// ---------------------------
 	op.setupConfigInformers()
 	// ---------------------------
@@ -79,3 +159,35 @@ func (c *OperatorConfig) New() (*Operator, error) {
 	}
 	return op, nil
 }
+
+// syncedResources returns the default resources along with the configured ones.
+func (c *OperatorConfig) syncedResources() ([]syncer.Resource, error) {
+	resources := syncer.DefaultResources()
+	if len(c.Resources) == 0 {
+		return resources, nil
+	}
+
+	mapper := discovery.NewResourceMapper(discovery.NewRestMapper(c.KubeClient.Discovery()))
+	for _, gvr := range c.Resources {
+		gvk, err := mapper.GVK(gvr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to detect kind of resource %s", gvr)
+		}
+		namespaced, err := mapper.IsGVRNamespaced(gvr)
+		if err != nil {
+			return nil, err
+		}
+		if !namespaced {
+			return nil, errors.Errorf("resource %s is not namespaced", gvr)
+		}
+
+		duplicate := false
+		for _, r := range resources {
+			duplicate = duplicate || r.GroupResource() == gvr.GroupResource()
+		}
+		if !duplicate {
+			resources = append(resources, syncer.NewResource(gvr, gvk.Kind))
+		}
+	}
+	return resources, nil
+}
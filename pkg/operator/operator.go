@@ -17,23 +17,26 @@ limitations under the License.
 package operator
 
 import (
-	"time"
+	"context"
 
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
 	"kubeops.dev/config-syncer/pkg/syncer"
 
 	"github.com/pkg/errors"
-	core "k8s.io/api/core/v1"
 	_ "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
-	core_informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	_ "kmodules.xyz/client-go/apiextensions/v1beta1"
+	"kmodules.xyz/client-go/meta"
 )
 
 type Operator struct {
@@ -44,8 +47,18 @@ type Operator struct {
 	recorder     record.EventRecorder
 	configSyncer *syncer.ConfigSyncer
 
-	KubeClient          kubernetes.Interface
-	kubeInformerFactory informers.SharedInformerFactory
+	KubeClient             kubernetes.Interface
+	DynamicClient          dynamic.Interface
+	kubeInformerFactory    informers.SharedInformerFactory
+	clusterInformerFactory informers.SharedInformerFactory
+	dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+	sourceInformerFactory  dynamicinformer.DynamicSharedInformerFactory
+	copyInformerFactory    dynamicinformer.DynamicSharedInformerFactory
+}
+
+// ConfigSyncer returns the syncer run by the operator.
+func (op *Operator) ConfigSyncer() *syncer.ConfigSyncer {
+	return op.configSyncer
 }
 
 func (op *Operator) Configure() error {
@@ -55,43 +68,117 @@ func (op *Operator) Configure() error {
 }
 
 func (op *Operator) setupConfigInformers() {
-	configMapInformer := op.kubeInformerFactory.InformerFor(&core.ConfigMap{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
-		return core_informers.NewFilteredConfigMapInformer(
-			client,
-			op.Config.ConfigSourceNamespace,
-			resyncPeriod,
-			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
-			func(options *metav1.ListOptions) {},
-		)
-	})
-	configMapInformer.AddEventHandler(op.configSyncer.ConfigMapHandler())
-
-	secretInformer := op.kubeInformerFactory.InformerFor(&core.Secret{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
-		return core_informers.NewFilteredSecretInformer(
-			client,
-			op.Config.ConfigSourceNamespace,
-			resyncPeriod,
-			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
-			func(options *metav1.ListOptions) {},
-		)
-	})
-	secretInformer.AddEventHandler(op.configSyncer.SecretHandler())
+	for _, gvr := range op.configSyncer.Resources() {
+		op.configSyncer.SetupResourceInformer(gvr, op.sourceInformerFactory.ForResource(gvr).Informer())
+		op.configSyncer.SetupCopyInformer(gvr, op.copyInformerFactory.ForResource(gvr).Informer())
+	}
 
 	nsInformer := op.kubeInformerFactory.Core().V1().Namespaces().Informer()
-	nsInformer.AddEventHandler(op.configSyncer.NamespaceHandler())
+	op.configSyncer.SetupNamespaceInformer(nsInformer)
+
+	if op.Config.ClusterSecretNamespace != "" {
+		clusterInformer := op.clusterInformerFactory.Core().V1().Secrets().Informer()
+		op.configSyncer.SetupClusterSecretInformer(clusterInformer)
+	}
+
+	if op.Config.AuthorizeSyncs {
+		webhookInformer := op.kubeInformerFactory.Admissionregistration().V1().MutatingWebhookConfigurations().Informer()
+		op.configSyncer.SetupRequesterWebhookInformer(webhookInformer)
+	}
+
+	policyInformer := op.dynamicInformerFactory.ForResource(api.SchemeGroupVersion.WithResource(api.ResourceSyncPolicies)).Informer()
+	op.configSyncer.SetupSyncPolicyInformer(policyInformer)
 }
 
 func (op *Operator) Run(stopCh <-chan struct{}) {
 	op.kubeInformerFactory.Start(stopCh)
-
-	res := op.kubeInformerFactory.WaitForCacheSync(stopCh)
-	for _, v := range res {
-		if !v {
-			runtime.HandleError(errors.Errorf("timed out waiting for caches to sync"))
-			return
+	op.clusterInformerFactory.Start(stopCh)
+	op.dynamicInformerFactory.Start(stopCh)
+	op.sourceInformerFactory.Start(stopCh)
+	op.copyInformerFactory.Start(stopCh)
+
+	for _, factory := range []informers.SharedInformerFactory{op.kubeInformerFactory, op.clusterInformerFactory} {
+		for _, v := range factory.WaitForCacheSync(stopCh) {
+			if !v {
+				runtime.HandleError(errors.Errorf("timed out waiting for caches to sync"))
+				return
+			}
+		}
+	}
+	for _, factory := range []dynamicinformer.DynamicSharedInformerFactory{op.dynamicInformerFactory, op.sourceInformerFactory, op.copyInformerFactory} {
+		for _, v := range factory.WaitForCacheSync(stopCh) {
+			if !v {
+				runtime.HandleError(errors.Errorf("timed out waiting for caches to sync"))
+				return
+			}
 		}
 	}
 
-	<-stopCh
+	if err := op.configSyncer.WatchKubeConfig(stopCh); err != nil {
+		runtime.HandleError(err)
+	}
+	op.configSyncer.RunClusterSecrets(stopCh)
+
+	if op.LeaderElection.LeaderElect {
+		// standby replicas keep their caches warm, only the leader syncs
+		op.runWithLeaderElection(stopCh)
+	} else {
+		op.configSyncer.Run(stopCh)
+		<-stopCh
+	}
 	klog.Infoln("Stopping config-syncer controller")
 }
+
+func (op *Operator) runWithLeaderElection(stopCh <-chan struct{}) {
+	id := meta.PodName() + "_" + string(uuid.NewUUID())
+	lock, err := resourcelock.New(
+		op.LeaderElection.ResourceLock,
+		op.LeaderElection.ResourceNamespace,
+		op.LeaderElection.ResourceName,
+		op.KubeClient.CoreV1(),
+		op.KubeClient.CoordinationV1(),
+		resourcelock.ResourceLockConfig{
+			Identity:      id,
+			EventRecorder: op.recorder,
+		},
+	)
+	if err != nil {
+		runtime.HandleError(errors.Wrap(err, "failed to create leader election lock"))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   op.LeaderElection.LeaseDuration.Duration,
+		RenewDeadline:   op.LeaderElection.RenewDeadline.Duration,
+		RetryPeriod:     op.LeaderElection.RetryPeriod.Duration,
+		ReleaseOnCancel: true,
+		Name:            op.LeaderElection.ResourceName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("%s started leading", id)
+				op.configSyncer.Run(ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				select {
+				case <-stopCh:
+					klog.Infof("%s released leadership", id)
+				default:
+					// exit, so that the restarted replica does not act on a stale queue
+					klog.Fatalf("%s lost leadership", id)
+				}
+			},
+			OnNewLeader: func(identity string) {
+				if identity != id {
+					klog.Infof("%s is the leader", identity)
+				}
+			},
+		},
+	})
+}
@@ -0,0 +1,142 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clustercontext
+
+import (
+	"context"
+
+	api "kubeops.dev/config-syncer/apis/syncer/v1alpha1"
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+// Storage serves ClusterContexts from the in-memory state of a ConfigSyncer.
+type Storage struct {
+	syncer *syncer.ConfigSyncer
+}
+
+var (
+	_ rest.GroupVersionKindProvider = &Storage{}
+	_ rest.Scoper                   = &Storage{}
+	_ rest.Storage                  = &Storage{}
+	_ rest.Getter                   = &Storage{}
+	_ rest.Lister                   = &Storage{}
+)
+
+func NewStorage(s *syncer.ConfigSyncer) *Storage {
+	return &Storage{syncer: s}
+}
+
+func (r *Storage) GroupVersionKind(_ schema.GroupVersion) schema.GroupVersionKind {
+	return api.SchemeGroupVersion.WithKind(api.ResourceKindClusterContext)
+}
+
+func (r *Storage) NamespaceScoped() bool {
+	return false
+}
+
+func (r *Storage) New() runtime.Object {
+	return &api.ClusterContext{}
+}
+
+func (r *Storage) Destroy() {}
+
+func (r *Storage) Get(_ context.Context, name string, _ *metav1.GetOptions) (runtime.Object, error) {
+	for _, obj := range r.syncer.ClusterContexts() {
+		if obj.Name == name {
+			return &obj, nil
+		}
+	}
+	return nil, apierrors.NewNotFound(api.Resource(api.ResourceClusterContexts), name)
+}
+
+func (r *Storage) NewList() runtime.Object {
+	return &api.ClusterContextList{}
+}
+
+func (r *Storage) List(_ context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	lsel, fsel := labels.Everything(), fields.Everything()
+	if options != nil && options.LabelSelector != nil {
+		lsel = options.LabelSelector
+	}
+	if options != nil && options.FieldSelector != nil {
+		fsel = options.FieldSelector
+	}
+	list := &api.ClusterContextList{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: api.SchemeGroupVersion.String(),
+			Kind:       api.ResourceKindClusterContext + "List",
+		},
+	}
+	for _, obj := range r.syncer.ClusterContexts() {
+		if lsel.Matches(labels.Set(obj.Labels)) && fsel.Matches(fields.Set{
+			"metadata.name": obj.Name,
+			"spec.cluster":  obj.Spec.Cluster,
+		}) {
+			list.Items = append(list.Items, obj)
+		}
+	}
+	return list, nil
+}
+
+func (r *Storage) ConvertToTable(_ context.Context, object runtime.Object, _ runtime.Object) (*metav1.Table, error) {
+	table := &metav1.Table{
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name of the context"},
+			{Name: "Cluster", Type: "string", Description: "Name of the cluster in the kubeconfig"},
+			{Name: "Address", Type: "string", Description: "Address of the API server"},
+			{Name: "Namespace", Type: "string", Description: "Namespace copies are synced into"},
+			{Name: "Healthy", Type: "boolean", Description: "Whether the context passes its health probes"},
+			{Name: "Secret", Type: "string", Description: "Cluster Secret that registered the context"},
+		},
+	}
+
+	var items []api.ClusterContext
+	switch t := object.(type) {
+	case *api.ClusterContext:
+		items = []api.ClusterContext{*t}
+	case *api.ClusterContextList:
+		items = t.Items
+		table.ResourceVersion = t.ResourceVersion
+	default:
+		return nil, apierrors.NewInternalError(errors.Errorf("unexpected object %T", object))
+	}
+	for i := range items {
+		obj := &items[i]
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				obj.Name,
+				obj.Spec.Cluster,
+				obj.Spec.Address,
+				obj.Spec.Namespace,
+				obj.Status.Healthy,
+				obj.Spec.Secret,
+			},
+			Object: runtime.RawExtension{Object: obj},
+		})
+	}
+	return table, nil
+}
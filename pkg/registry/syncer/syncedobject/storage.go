@@ -0,0 +1,164 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncedobject
+
+import (
+	"context"
+	"strings"
+
+	api "kubeops.dev/config-syncer/apis/syncer/v1alpha1"
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+// Storage serves SyncedObjects from the in-memory state of a ConfigSyncer.
+type Storage struct {
+	syncer *syncer.ConfigSyncer
+}
+
+var (
+	_ rest.GroupVersionKindProvider = &Storage{}
+	_ rest.Scoper                   = &Storage{}
+	_ rest.Storage                  = &Storage{}
+	_ rest.Getter                   = &Storage{}
+	_ rest.Lister                   = &Storage{}
+)
+
+func NewStorage(s *syncer.ConfigSyncer) *Storage {
+	return &Storage{syncer: s}
+}
+
+func (r *Storage) GroupVersionKind(_ schema.GroupVersion) schema.GroupVersionKind {
+	return api.SchemeGroupVersion.WithKind(api.ResourceKindSyncedObject)
+}
+
+func (r *Storage) NamespaceScoped() bool {
+	return true
+}
+
+func (r *Storage) New() runtime.Object {
+	return &api.SyncedObject{}
+}
+
+func (r *Storage) Destroy() {}
+
+func (r *Storage) Get(ctx context.Context, name string, _ *metav1.GetOptions) (runtime.Object, error) {
+	ns, ok := apirequest.NamespaceFrom(ctx)
+	if !ok || ns == "" {
+		return nil, apierrors.NewBadRequest("namespace is required")
+	}
+	obj, err := r.syncer.SyncedObject(ns, name)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+	if obj == nil {
+		return nil, apierrors.NewNotFound(api.Resource(api.ResourceSyncedObjects), name)
+	}
+	return obj, nil
+}
+
+func (r *Storage) NewList() runtime.Object {
+	return &api.SyncedObjectList{}
+}
+
+func (r *Storage) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	objs, err := r.syncer.SyncedObjects(apirequest.NamespaceValue(ctx))
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+
+	lsel, fsel := labels.Everything(), fields.Everything()
+	if options != nil && options.LabelSelector != nil {
+		lsel = options.LabelSelector
+	}
+	if options != nil && options.FieldSelector != nil {
+		fsel = options.FieldSelector
+	}
+	list := &api.SyncedObjectList{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: api.SchemeGroupVersion.String(),
+			Kind:       api.ResourceKindSyncedObject + "List",
+		},
+	}
+	for _, obj := range objs {
+		if lsel.Matches(labels.Set(obj.Labels)) && fsel.Matches(fields.Set{
+			"metadata.name":      obj.Name,
+			"metadata.namespace": obj.Namespace,
+			"status.phase":       string(obj.Status.Phase),
+		}) {
+			list.Items = append(list.Items, obj)
+		}
+	}
+	return list, nil
+}
+
+func (r *Storage) ConvertToTable(_ context.Context, object runtime.Object, _ runtime.Object) (*metav1.Table, error) {
+	table := &metav1.Table{
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name of the SyncedObject"},
+			{Name: "Kind", Type: "string", Description: "Kind of the source"},
+			{Name: "Phase", Type: "string", Description: "Whether the source was synced into every target"},
+			{Name: "Namespaces", Type: "integer", Description: "Number of target namespaces"},
+			{Name: "Contexts", Type: "string", Description: "Target contexts"},
+			{Name: "Age", Type: "string", Description: "Age of the source"},
+		},
+	}
+
+	var items []api.SyncedObject
+	switch t := object.(type) {
+	case *api.SyncedObject:
+		items = []api.SyncedObject{*t}
+	case *api.SyncedObjectList:
+		items = t.Items
+		table.ResourceVersion = t.ResourceVersion
+	default:
+		return nil, apierrors.NewInternalError(errors.Errorf("unexpected object %T", object))
+	}
+	for i := range items {
+		obj := &items[i]
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				obj.Name,
+				obj.Spec.Source.Kind,
+				string(obj.Status.Phase),
+				int64(len(obj.Spec.Namespaces)),
+				strings.Join(obj.Spec.Contexts, ","),
+				age(obj.CreationTimestamp),
+			},
+			Object: runtime.RawExtension{Object: obj},
+		})
+	}
+	return table, nil
+}
+
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(metav1.Now().Sub(t.Time))
+}
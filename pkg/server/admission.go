@@ -0,0 +1,172 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	"github.com/pkg/errors"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+// ValidatingWebhookPath is the path of the validating admission webhook for sync annotations.
+const ValidatingWebhookPath = syncer.ValidatingWebhookPath
+
+// MutatingWebhookPath is the path of the mutating admission webhook that stamps the requester of syncs.
+const MutatingWebhookPath = syncer.MutatingWebhookPath
+
+// maxReviewSize is the largest AdmissionReview accepted. Objects in etcd are limited to 1.5MiB,
+// and a review holds the old and the new object.
+const maxReviewSize = 4 << 20
+
+type sourceValidator struct {
+	syncer *syncer.ConfigSyncer
+}
+
+func (v *sourceValidator) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	serveReview(w, req, v.review)
+}
+
+type requesterStamper struct {
+	syncer *syncer.ConfigSyncer
+}
+
+func (m *requesterStamper) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	serveReview(w, req, m.review)
+}
+
+// serveReview answers the AdmissionReview in the body of req with the response of review.
+func serveReview(w http.ResponseWriter, req *http.Request, review func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxReviewSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ar admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &ar); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ar.Request == nil {
+		http.Error(w, "admission review has no request", http.StatusBadRequest)
+		return
+	}
+
+	ar.Response = review(ar.Request)
+	ar.Response.UID = ar.Request.UID
+	ar.Request = nil
+	data, err := json.Marshal(ar)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		klog.Errorln(err)
+	}
+}
+
+func (v *sourceValidator) review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	gvr, old, obj, err := decodeRequest(req)
+	if err != nil {
+		return deny(http.StatusBadRequest, metav1.StatusReasonBadRequest, err)
+	}
+	if err := v.syncer.ValidateSource(gvr, old, obj); err != nil {
+		return deny(http.StatusUnprocessableEntity, metav1.StatusReasonInvalid, err)
+	}
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+func (m *requesterStamper) review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	gvr, old, obj, err := decodeRequest(req)
+	if err != nil {
+		return deny(http.StatusBadRequest, metav1.StatusReasonBadRequest, err)
+	}
+	annotations, err := m.syncer.StampRequester(gvr, old, obj, req.UserInfo)
+	if err != nil {
+		return deny(http.StatusInternalServerError, metav1.StatusReasonInternalError, err)
+	}
+	if annotations == nil {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "add", "path": "/metadata/annotations", "value": annotations},
+	})
+	if err != nil {
+		return deny(http.StatusInternalServerError, metav1.StatusReasonInternalError, err)
+	}
+	patchType := admissionv1.PatchTypeJSONPatch
+	return &admissionv1.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &patchType}
+}
+
+// decodeRequest returns the resource of req along with its old and new object. old is nil unless req is an update.
+func decodeRequest(req *admissionv1.AdmissionRequest) (schema.GroupVersionResource, metav1.Object, *unstructured.Unstructured, error) {
+	gvr := schema.GroupVersionResource{Group: req.Resource.Group, Version: req.Resource.Version, Resource: req.Resource.Resource}
+	obj, err := decodeObject(req.Object.Raw)
+	if err != nil {
+		return gvr, nil, nil, err
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace(req.Namespace)
+	}
+	if req.Operation != admissionv1.Update {
+		return gvr, nil, obj, nil
+	}
+	old, err := decodeObject(req.OldObject.Raw)
+	if err != nil {
+		return gvr, nil, nil, err
+	}
+	return gvr, old, obj, nil
+}
+
+func decodeObject(raw []byte) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(raw); err != nil {
+		return nil, errors.Wrap(err, "failed to decode object")
+	}
+	return obj, nil
+}
+
+func deny(code int32, reason metav1.StatusReason, err error) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    code,
+			Reason:  reason,
+			Message: err.Error(),
+		},
+	}
+}
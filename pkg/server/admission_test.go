@@ -0,0 +1,148 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kubeops.dev/config-syncer/pkg/syncer"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+)
+
+func newConfigMap(annotations map[string]string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "omni", "namespace": "demo", "annotations": annotations},
+	})
+	return data
+}
+
+func serve(t *testing.T, h http.Handler, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	t.Helper()
+	req.UID = "42"
+	req.Resource = metav1.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	body, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request:  req,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(w.Body.Bytes(), &review); err != nil {
+		t.Fatal(err)
+	}
+	if review.Response == nil || review.Response.UID != "42" {
+		t.Fatalf("response = %+v, want the UID of the request", review.Response)
+	}
+	return review.Response
+}
+
+func newSyncer(opts syncer.Options) *syncer.ConfigSyncer {
+	opts.Resources = syncer.DefaultResources()
+	return syncer.New(fake.NewSimpleClientset(), dynamicfake.NewSimpleDynamicClient(scheme.Scheme), record.NewFakeRecorder(10), opts)
+}
+
+func TestSourceValidator(t *testing.T) {
+	v := &sourceValidator{syncer: newSyncer(syncer.Options{})}
+
+	resp := serve(t, v, &admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: newConfigMap(map[string]string{syncer.ConfigSyncKey: "app in (demo"})},
+	})
+	if resp.Allowed || resp.Result == nil || resp.Result.Code != http.StatusUnprocessableEntity {
+		t.Errorf("response = %+v, want the invalid selector to be denied", resp)
+	}
+
+	resp = serve(t, v, &admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: newConfigMap(map[string]string{syncer.ConfigSyncKey: "app=demo"})},
+	})
+	if !resp.Allowed {
+		t.Errorf("response = %+v, want a valid selector to be allowed", resp)
+	}
+
+	resp = serve(t, v, &admissionv1.AdmissionRequest{Operation: admissionv1.Delete})
+	if !resp.Allowed {
+		t.Errorf("response = %+v, want deletes to be allowed", resp)
+	}
+}
+
+func TestRequesterStamper(t *testing.T) {
+	m := &requesterStamper{syncer: newSyncer(syncer.Options{AuthorizeSyncs: true, RequesterKey: []byte("0123456789abcdef0123456789abcdef")})}
+	alice := authenticationv1.UserInfo{Username: "alice", Groups: []string{"dev"}}
+
+	obj := newConfigMap(map[string]string{syncer.ConfigSyncKey: "true", syncer.ConfigRequestedBy: `{"username":"admin"}`})
+	resp := serve(t, m, &admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		UserInfo:  alice,
+		Object:    runtime.RawExtension{Raw: obj},
+	})
+	if !resp.Allowed || resp.PatchType == nil || *resp.PatchType != admissionv1.PatchTypeJSONPatch {
+		t.Fatalf("response = %+v, want a JSON patch", resp)
+	}
+	patch, err := jsonpatch.DecodePatch(resp.Patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := patch.Apply(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(patched); err != nil {
+		t.Fatal(err)
+	}
+	annotations := u.GetAnnotations()
+	if want := `{"username":"alice","groups":["dev"]}`; annotations[syncer.ConfigRequestedBy] != want {
+		t.Errorf("requester = %s, want %s", annotations[syncer.ConfigRequestedBy], want)
+	}
+	if annotations[syncer.ConfigRequesterSignature] == "" || annotations[syncer.ConfigSyncKey] != "true" {
+		t.Errorf("annotations = %v, want the signature along with the sync annotations", annotations)
+	}
+
+	// updates that leave the sync annotations alone are not patched
+	resp = serve(t, m, &admissionv1.AdmissionRequest{
+		Operation: admissionv1.Update,
+		UserInfo:  authenticationv1.UserInfo{Username: "bob"},
+		Object:    runtime.RawExtension{Raw: patched},
+		OldObject: runtime.RawExtension{Raw: patched},
+	})
+	if !resp.Allowed || resp.Patch != nil {
+		t.Errorf("response = %+v, want no patch", resp)
+	}
+}
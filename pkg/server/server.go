@@ -17,13 +17,18 @@ limitations under the License.
 package server
 
 import (
+	"kubeops.dev/config-syncer/apis/syncer/install"
+	syncerv1alpha1 "kubeops.dev/config-syncer/apis/syncer/v1alpha1"
 	"kubeops.dev/config-syncer/pkg/operator"
+	"kubeops.dev/config-syncer/pkg/registry/syncer/clustercontext"
+	"kubeops.dev/config-syncer/pkg/registry/syncer/syncedobject"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apiserver/pkg/registry/rest"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 )
 
@@ -33,7 +38,7 @@ var (
 )
 
 func init() {
-	// install.Install(Scheme)
+	install.Install(Scheme)
 
 	// we need to add the options to empty v1
 	// TODO fix the server code to avoid this
@@ -102,6 +107,22 @@ func (c completedConfig) New() (*ConfigSyncerServer, error) {
 		return nil, err
 	}
 
+	genericServer.Handler.NonGoRestfulMux.Handle(ValidatingWebhookPath, &sourceValidator{syncer: operator.ConfigSyncer()})
+	genericServer.Handler.NonGoRestfulMux.Handle(MutatingWebhookPath, &requesterStamper{syncer: operator.ConfigSyncer()})
+
+	{
+		apiGroupInfo := genericapiserver.NewDefaultAPIGroupInfo(syncerv1alpha1.GroupName, Scheme, metav1.ParameterCodec, Codecs)
+
+		v1alpha1storage := map[string]rest.Storage{}
+		v1alpha1storage[syncerv1alpha1.ResourceSyncedObjects] = syncedobject.NewStorage(operator.ConfigSyncer())
+		v1alpha1storage[syncerv1alpha1.ResourceClusterContexts] = clustercontext.NewStorage(operator.ConfigSyncer())
+		apiGroupInfo.VersionedResourcesStorageMap[syncerv1alpha1.SchemeGroupVersion.Version] = v1alpha1storage
+
+		if err := genericServer.InstallAPIGroup(&apiGroupInfo); err != nil {
+			return nil, err
+		}
+	}
+
 	s := &ConfigSyncerServer{
 		GenericAPIServer: genericServer,
 		Operator:         operator,
@@ -0,0 +1,461 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	"github.com/pkg/errors"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+const (
+	authzCacheSize = 4096
+	authzCacheTTL  = time.Minute
+)
+
+// ValidatingWebhookPath is the path of the validating admission webhook for sync annotations.
+const ValidatingWebhookPath = "/validate/sync-annotations"
+
+// MutatingWebhookPath is the path of the mutating admission webhook that stamps the requester of syncs.
+const MutatingWebhookPath = "/mutate/sync-annotations"
+
+// requesterKeyLength is the size in bytes of the key that signs the sync-requested-by annotation.
+const requesterKeyLength = 32
+
+// LoadRequesterKey returns the key that signs the sync-requested-by annotation. The key is kept in the Secret
+// namespace/name, which is created with a random key if it does not exist, so every replica signs with the same key.
+func LoadRequesterKey(kc kubernetes.Interface, namespace, name string) ([]byte, error) {
+	secret, err := kc.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		key := make([]byte, requesterKeyLength)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		secret, err = kc.CoreV1().Secrets(namespace).Create(context.TODO(), &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       map[string][]byte{RequesterKeySecretKey: key},
+		}, metav1.CreateOptions{})
+		if kerr.IsAlreadyExists(err) {
+			// created by another replica
+			secret, err = kc.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load requester key from secret %s/%s", namespace, name)
+	}
+	key := secret.Data[RequesterKeySecretKey]
+	if len(key) < requesterKeyLength {
+		return nil, errors.Errorf("secret %s/%s must hold a key of at least %d bytes in %s", namespace, name, requesterKeyLength, RequesterKeySecretKey)
+	}
+	return key, nil
+}
+
+// LoadRequesterWebhooks looks up the mutating webhooks that stamp the sync-requested-by annotation, which
+// is otherwise writable by anyone who may annotate a source. It returns an error unless every synced
+// resource is created and updated through the webhook of Config Syncer with failure policy Fail.
+// Sources in namespaces the webhooks skip are not authorized.
+func (s *ConfigSyncer) LoadRequesterWebhooks() error {
+	configs, err := s.kubeClient.AdmissionregistrationV1().MutatingWebhookConfigurations().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list mutating webhook configurations")
+	}
+	webhooks, err := s.requesterWebhooksFrom(configs.Items)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.requesterWebhooks = webhooks
+	s.lock.Unlock()
+	return nil
+}
+
+// SetupRequesterWebhookInformer reloads the webhooks that stamp the sync-requested-by annotation whenever a
+// MutatingWebhookConfiguration changes, and resyncs the sources synced via annotations if they changed.
+func (s *ConfigSyncer) SetupRequesterWebhookInformer(informer cache.SharedIndexInformer) {
+	reload := func() {
+		var configs []admissionregistrationv1.MutatingWebhookConfiguration
+		for _, obj := range informer.GetIndexer().List() {
+			configs = append(configs, *obj.(*admissionregistrationv1.MutatingWebhookConfiguration))
+		}
+		s.reloadRequesterWebhooks(configs)
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { reload() },
+		UpdateFunc: func(interface{}, interface{}) { reload() },
+		DeleteFunc: func(interface{}) { reload() },
+	})
+}
+
+func (s *ConfigSyncer) reloadRequesterWebhooks(configs []admissionregistrationv1.MutatingWebhookConfiguration) {
+	webhooks, err := s.requesterWebhooksFrom(configs)
+	if err != nil {
+		// the resources without a webhook are refused until one is registered
+		klog.Warningln(err)
+	}
+
+	s.lock.Lock()
+	changed := !reflect.DeepEqual(s.requesterWebhooks, webhooks)
+	s.requesterWebhooks = webhooks
+	leading := s.leading
+	s.lock.Unlock()
+	if !changed || !leading {
+		return
+	}
+	klog.Infoln("webhooks stamping sync requesters changed, resyncing sources")
+	for _, r := range s.resources {
+		for _, obj := range r.indexer.List() {
+			if src := obj.(*unstructured.Unstructured); hasSyncAnnotations(src) && !isSyncStatus(src) {
+				queue.Enqueue(r.queue.GetQueue(), src)
+			}
+		}
+	}
+}
+
+// requesterWebhooksFrom returns the namespace selectors of the webhooks in configs that stamp the
+// sync-requested-by annotation, by resource. The error lists the resources that no webhook covers.
+func (s *ConfigSyncer) requesterWebhooksFrom(configs []admissionregistrationv1.MutatingWebhookConfiguration) (map[schema.GroupVersionResource][]labels.Selector, error) {
+	webhooks := map[schema.GroupVersionResource][]labels.Selector{}
+	var errs []error
+	for _, cfg := range configs {
+		for _, w := range cfg.Webhooks {
+			if !stampsRequester(w) {
+				continue
+			}
+			sel := labels.Everything()
+			if w.NamespaceSelector != nil {
+				var err error
+				if sel, err = metav1.LabelSelectorAsSelector(w.NamespaceSelector); err != nil {
+					errs = append(errs, errors.Wrapf(err, "invalid namespace selector of webhook %s", w.Name))
+					continue
+				}
+			}
+			for _, r := range s.resources {
+				if rulesCover(w.Rules, r.GroupVersionResource) {
+					webhooks[r.GroupVersionResource] = append(webhooks[r.GroupVersionResource], sel)
+				}
+			}
+		}
+	}
+
+	for _, r := range s.resources {
+		if len(webhooks[r.GroupVersionResource]) == 0 {
+			errs = append(errs, errors.Errorf("%s are not created and updated through a webhook at path %s with failure policy Fail", r.GroupVersionResource.Resource, MutatingWebhookPath))
+		}
+	}
+	if len(errs) > 0 {
+		return webhooks, errors.Wrap(utilerrors.NewAggregate(errs), "--authorize-syncs requires the admission webhook")
+	}
+	return webhooks, nil
+}
+
+// stampsRequester returns true if the webhook is served by Config Syncer and rejects objects when it can not be called.
+func stampsRequester(w admissionregistrationv1.MutatingWebhook) bool {
+	if w.FailurePolicy != nil && *w.FailurePolicy != admissionregistrationv1.Fail {
+		return false
+	}
+	if w.ObjectSelector != nil && (len(w.ObjectSelector.MatchLabels) > 0 || len(w.ObjectSelector.MatchExpressions) > 0) {
+		return false
+	}
+	if svc := w.ClientConfig.Service; svc != nil {
+		return svc.Path != nil && *svc.Path == MutatingWebhookPath
+	}
+	if w.ClientConfig.URL != nil {
+		u, err := url.Parse(*w.ClientConfig.URL)
+		return err == nil && u.Path == MutatingWebhookPath
+	}
+	return false
+}
+
+// rulesCover returns true if the rules send both creates and updates of the namespaced resource to the webhook.
+func rulesCover(rules []admissionregistrationv1.RuleWithOperations, gvr schema.GroupVersionResource) bool {
+	matches := func(values []string, v string) bool {
+		for _, value := range values {
+			if value == "*" || value == v {
+				return true
+			}
+		}
+		return false
+	}
+	covers := func(op admissionregistrationv1.OperationType) bool {
+		for _, rule := range rules {
+			if rule.Scope != nil && *rule.Scope == admissionregistrationv1.ClusterScope {
+				continue
+			}
+			ops := make([]string, 0, len(rule.Operations))
+			for _, o := range rule.Operations {
+				ops = append(ops, string(o))
+			}
+			if matches(ops, string(op)) && matches(rule.APIGroups, gvr.Group) && matches(rule.APIVersions, gvr.Version) &&
+				(matches(rule.Resources, gvr.Resource) || matches(rule.Resources, "*/*")) {
+				return true
+			}
+		}
+		return false
+	}
+	return covers(admissionregistrationv1.Create) && covers(admissionregistrationv1.Update)
+}
+
+// StampRequester returns the annotations of obj with the sync-requested-by annotation set to user, on behalf
+// of the mutating admission webhook. old is nil on create. The annotation is stamped whenever a sync
+// annotation changes, including the sync-requested-by annotation itself, and signed along with the other
+// sync annotations, so annotations written without the webhook are never trusted. It returns nil if the
+// annotations of obj stay as they are.
+func (s *ConfigSyncer) StampRequester(gvr schema.GroupVersionResource, old, obj metav1.Object, user authenticationv1.UserInfo) (map[string]string, error) {
+	r := s.resourceFor(gvr)
+	if !s.authorizeSyncs || r == nil {
+		return nil, nil
+	}
+	annotations := map[string]string{}
+	for k, v := range obj.GetAnnotations() {
+		annotations[k] = v
+	}
+
+	if !hasSyncAnnotations(obj) {
+		_, requested := annotations[ConfigRequestedBy]
+		_, signed := annotations[ConfigRequesterSignature]
+		if !requested && !signed {
+			return nil, nil
+		}
+		delete(annotations, ConfigRequestedBy)
+		delete(annotations, ConfigRequesterSignature)
+		return annotations, nil
+	}
+	if old != nil && !syncAnnotationsChanged(old, obj) {
+		return nil, nil
+	}
+
+	requester, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	annotations[ConfigRequestedBy] = string(requester)
+	annotations[ConfigRequesterSignature] = s.requesterSignature(r, obj.GetNamespace(), annotations)
+	return annotations, nil
+}
+
+// requesterSignature signs the sync annotations of a source of resource r in namespace.
+func (s *ConfigSyncer) requesterSignature(r *resourceSyncer, namespace string, annotations map[string]string) string {
+	mac := hmac.New(sha256.New, s.requesterKey)
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%s\n", r.Group, r.GroupVersionResource.Resource, namespace)
+	for _, key := range syncAnnotationKeys.List() {
+		if v, ok := annotations[key]; ok && key != ConfigRequesterSignature {
+			_, _ = fmt.Fprintf(mac, "%s=%q\n", key, v)
+		}
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyRequesterStamp checks that the sync annotations of src were stamped by the mutating admission webhook.
+func (s *ConfigSyncer) verifyRequesterStamp(r *resourceSyncer, src metav1.Object) error {
+	annotations := src.GetAnnotations()
+	signature, ok := annotations[ConfigRequesterSignature]
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.requesterSignature(r, src.GetNamespace(), annotations))) {
+		return errors.Errorf("%s annotation was not stamped by the admission webhook", ConfigRequestedBy)
+	}
+	return nil
+}
+
+// verifiedRequesterOf returns the user recorded in the sync-requested-by annotation of src. The annotation
+// is only trusted if the admission webhook stamped it, and if a webhook covers the namespace of src.
+func (s *ConfigSyncer) verifiedRequesterOf(r *resourceSyncer, src metav1.Object) (*authenticationv1.UserInfo, error) {
+	ns, err := s.getNamespace(src.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	verified := false
+	for _, sel := range s.requesterWebhooks[r.GroupVersionResource] {
+		if sel.Matches(labels.Set(ns.Labels)) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.Errorf("%s annotations in namespace %s are not stamped by the admission webhook", ConfigRequestedBy, src.GetNamespace())
+	}
+	if err := s.verifyRequesterStamp(r, src); err != nil {
+		return nil, err
+	}
+	return requesterOf(src)
+}
+
+// requesterOf returns the user recorded in the sync-requested-by annotation of src.
+func requesterOf(src metav1.Object) (*authenticationv1.UserInfo, error) {
+	v, ok := src.GetAnnotations()[ConfigRequestedBy]
+	if !ok {
+		return nil, errors.Errorf("missing %s annotation", ConfigRequestedBy)
+	}
+	var user authenticationv1.UserInfo
+	if err := json.Unmarshal([]byte(v), &user); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s annotation", ConfigRequestedBy)
+	}
+	if user.Username == "" {
+		return nil, errors.Errorf("invalid %s annotation: missing username", ConfigRequestedBy)
+	}
+	return &user, nil
+}
+
+// authorizeNamespaces returns the namespaces of newNs that src may be copied into. Namespaces selected
+// by a SyncPolicy are authorized by the policy. Namespaces that are only selected by the sync annotation
+// of src are refused unless the requester of the sync may create the copy there.
+func (s *ConfigSyncer) authorizeNamespaces(r *resourceSyncer, src *unstructured.Unstructured, newNs sets.String, report *syncReport) (sets.String, error) {
+	if !s.authorizeSyncs || newNs.Len() == 0 {
+		return newNs, nil
+	}
+	granted := sets.NewString()
+	for _, policy := range s.syncPoliciesFor(r.SourceKind(), src) {
+		selectors, err := policy.NamespaceSelectors()
+		if err != nil {
+			continue
+		}
+		ns, err := s.namespacesForSelectors(r.Kind, selectors, src)
+		if err != nil {
+			return nil, err
+		}
+		granted = granted.Union(ns)
+	}
+
+	allowed := sets.NewString()
+	for _, ns := range newNs.List() {
+		if granted.Has(ns) {
+			allowed.Insert(ns)
+			continue
+		}
+		reason, err := s.authorize(r, src, ns)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			s.recordRefused(src, report, "", ns, reason)
+			continue
+		}
+		allowed.Insert(ns)
+	}
+	return allowed, nil
+}
+
+// authorizeContexts returns the contexts of src that it may be copied into. The requester of a sync can
+// not be authorized in remote clusters, so only the contexts selected by a SyncPolicy are allowed.
+func (s *ConfigSyncer) authorizeContexts(r *resourceSyncer, src *unstructured.Unstructured, contexts sets.String, report *syncReport) sets.String {
+	if !s.authorizeSyncs || contexts.Len() == 0 {
+		return contexts
+	}
+	granted := sets.NewString()
+	for _, policy := range s.syncPoliciesFor(r.SourceKind(), src) {
+		granted.Insert(policy.Spec.Target.Contexts...)
+	}
+	for _, ctx := range contexts.Difference(granted).List() {
+		namespace := src.GetNamespace()
+		if c, found := s.contexts[ctx]; found && c.Namespace != "" {
+			namespace = c.Namespace
+		}
+		s.recordRefused(src, report, ctx, namespace, "contexts can only be selected by a SyncPolicy when syncs are authorized")
+	}
+	return contexts.Intersection(granted)
+}
+
+// authorizedVerbs are the verbs the requester of a sync needs in a target namespace, since Config Syncer
+// creates, updates and patches the copy there, and deletes it once the source stops selecting the namespace.
+var authorizedVerbs = []string{"create", "update", "patch", "delete"}
+
+// authorize asks the API server whether the requester of the sync of src may create, update and delete the copy
+// in namespace. It returns why the copy is refused, or an empty string if it is allowed.
+func (s *ConfigSyncer) authorize(r *resourceSyncer, src metav1.Object, namespace string) (string, error) {
+	user, err := s.verifiedRequesterOf(r, src)
+	if err != nil {
+		return err.Error(), nil
+	}
+	key := strings.Join([]string{user.Username, user.UID, strings.Join(user.Groups, ","), r.Group, r.GroupVersionResource.Resource, namespace}, "/")
+	if v, ok := s.authzCache.Get(key); ok {
+		return v.(string), nil
+	}
+
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	var denied, reasons []string
+	for _, verb := range authorizedVerbs {
+		review, err := s.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(context.TODO(), &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      verb,
+					Group:     r.Group,
+					Version:   r.Version,
+					Resource:  r.GroupVersionResource.Resource,
+				},
+				User:   user.Username,
+				UID:    user.UID,
+				Groups: user.Groups,
+				Extra:  extra,
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return "", err
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, verb)
+			if review.Status.Reason != "" {
+				reasons = append(reasons, review.Status.Reason)
+			}
+		}
+	}
+	reason := ""
+	if len(denied) > 0 {
+		reason = fmt.Sprintf("user %s may not %s %s in namespace %s", user.Username, strings.Join(denied, ", "), r.GroupVersionResource.Resource, namespace)
+		if len(reasons) > 0 {
+			reason += ": " + strings.Join(sets.NewString(reasons...).List(), ", ")
+		}
+	}
+	s.authzCache.Add(key, reason, authzCacheTTL)
+	return reason, nil
+}
+
+func (s *ConfigSyncer) recordRefused(src runtime.Object, report *syncReport, ctx, namespace, reason string) {
+	report.skipped(ctx, namespace, reason)
+	kind, srcNs := sourceLabels(src)
+	syncAttempts.WithLabelValues(kind, srcNs, ctx).Inc()
+	syncSkips.WithLabelValues(kind, srcNs, ctx).Inc()
+	s.recorder.Eventf(src, core.EventTypeWarning, eventer.EventReasonSyncRefused, "Refused to sync into %s: %s", describeTarget(ctx, namespace), reason)
+}
@@ -0,0 +1,359 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var testRequesterKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newRequesterWebhook(namespaceSelector *metav1.LabelSelector, resources ...string) *admissionregistrationv1.MutatingWebhookConfiguration {
+	path := MutatingWebhookPath
+	fail := admissionregistrationv1.Fail
+	return &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "config-syncer"},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{{
+			Name:              "sync-requester.config-syncer.kubeops.dev",
+			FailurePolicy:     &fail,
+			NamespaceSelector: namespaceSelector,
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service: &admissionregistrationv1.ServiceReference{Namespace: "kube-system", Name: "config-syncer", Path: &path},
+			},
+			Rules: []admissionregistrationv1.RuleWithOperations{{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   resources,
+				},
+			}},
+		}},
+	}
+}
+
+// stamp stamps the sync annotations of src as the mutating webhook would on create.
+func (ts *testSyncer) stamp(t *testing.T, src *core.ConfigMap, user authenticationv1.UserInfo) {
+	t.Helper()
+	annotations, err := ts.StampRequester(ConfigMaps.GroupVersionResource, nil, toUnstructured(t, src), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Annotations = annotations
+}
+
+func TestLoadRequesterKey(t *testing.T) {
+	kc := fake.NewSimpleClientset()
+	key, err := LoadRequesterKey(kc, "kube-system", "requester-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != requesterKeyLength {
+		t.Errorf("len(key) = %d, want %d", len(key), requesterKeyLength)
+	}
+	again, err := LoadRequesterKey(kc, "kube-system", "requester-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(key) {
+		t.Error("LoadRequesterKey() returned another key for the existing secret")
+	}
+
+	short := &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "short", Namespace: "kube-system"},
+		Data:       map[string][]byte{RequesterKeySecretKey: []byte("short")},
+	}
+	if _, err := LoadRequesterKey(fake.NewSimpleClientset(short), "kube-system", "short"); err == nil {
+		t.Error("LoadRequesterKey() accepted a short key")
+	}
+}
+
+func TestStampRequester(t *testing.T) {
+	alice := authenticationv1.UserInfo{Username: "alice", UID: "1", Groups: []string{"dev"}}
+	bob := authenticationv1.UserInfo{Username: "bob"}
+	synced := map[string]string{ConfigSyncKey: "true"}
+
+	ts := newTestSyncer(t, Options{AuthorizeSyncs: true, RequesterKey: testRequesterKey})
+	stamped := newConfigMap("demo", "omni", synced)
+	ts.stamp(t, stamped, alice)
+
+	withAnnotations := func(annotations map[string]string) *core.ConfigMap {
+		cm := stamped.DeepCopy()
+		for k, v := range annotations {
+			cm.Annotations[k] = v
+		}
+		return cm
+	}
+
+	cases := []struct {
+		name        string
+		authorize   bool
+		old         *core.ConfigMap
+		obj         *core.ConfigMap
+		wantStamp   bool
+		wantRemoved bool
+	}{
+		{
+			name:      "create",
+			authorize: true,
+			obj:       newConfigMap("demo", "omni", synced),
+			wantStamp: true,
+		},
+		{
+			name:      "create without sync annotations",
+			authorize: true,
+			obj:       newConfigMap("demo", "omni", nil),
+		},
+		{
+			name:      "update data",
+			authorize: true,
+			old:       stamped,
+			obj:       stamped.DeepCopy(),
+		},
+		{
+			name:      "update sync annotations",
+			authorize: true,
+			old:       stamped,
+			obj:       withAnnotations(map[string]string{ConfigSyncKey: "app=demo"}),
+			wantStamp: true,
+		},
+		{
+			name:      "forge requester",
+			authorize: true,
+			old:       stamped,
+			obj:       withAnnotations(map[string]string{ConfigRequestedBy: `{"username":"admin"}`}),
+			wantStamp: true,
+		},
+		{
+			name:        "remove sync annotations",
+			authorize:   true,
+			old:         stamped,
+			obj:         newConfigMap("demo", "omni", map[string]string{ConfigRequestedBy: `{"username":"alice"}`, ConfigRequesterSignature: "x"}),
+			wantRemoved: true,
+		},
+		{
+			name: "syncs not authorized",
+			obj:  newConfigMap("demo", "omni", synced),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := newTestSyncer(t, Options{AuthorizeSyncs: c.authorize, RequesterKey: testRequesterKey})
+			var oldObj metav1.Object
+			if c.old != nil {
+				oldObj = toUnstructured(t, c.old)
+			}
+			obj := toUnstructured(t, c.obj)
+			annotations, err := ts.StampRequester(ConfigMaps.GroupVersionResource, oldObj, obj, bob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case c.wantStamp:
+				obj.SetAnnotations(annotations)
+				user, err := requesterOf(obj)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(*user, bob) {
+					t.Errorf("requester = %+v, want %+v", *user, bob)
+				}
+				if err := ts.verifyRequesterStamp(ts.resourceFor(ConfigMaps.GroupVersionResource), obj); err != nil {
+					t.Errorf("verifyRequesterStamp() = %v", err)
+				}
+			case c.wantRemoved:
+				_, requested := annotations[ConfigRequestedBy]
+				_, signed := annotations[ConfigRequesterSignature]
+				if annotations == nil || requested || signed {
+					t.Errorf("annotations = %v, want the requester removed", annotations)
+				}
+			case annotations != nil:
+				t.Errorf("annotations = %v, want them unchanged", annotations)
+			}
+		})
+	}
+}
+
+func TestVerifiedRequesterOf(t *testing.T) {
+	alice := authenticationv1.UserInfo{Username: "alice"}
+	covered := &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}}
+
+	cases := []struct {
+		name    string
+		src     func(ts *testSyncer) *core.ConfigMap
+		wantErr string
+	}{
+		{
+			name: "stamped",
+			src: func(ts *testSyncer) *core.ConfigMap {
+				src := newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"})
+				ts.stamp(t, src, alice)
+				return src
+			},
+		},
+		{
+			name: "written before the webhook",
+			src: func(*testSyncer) *core.ConfigMap {
+				return newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true", ConfigRequestedBy: `{"username":"alice"}`})
+			},
+			wantErr: "not stamped",
+		},
+		{
+			name: "signed with another key",
+			src: func(*testSyncer) *core.ConfigMap {
+				other := newTestSyncer(t, Options{AuthorizeSyncs: true, RequesterKey: []byte("fedcba9876543210fedcba9876543210")})
+				src := newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"})
+				other.stamp(t, src, alice)
+				return src
+			},
+			wantErr: "not stamped",
+		},
+		{
+			name: "selector changed after stamping",
+			src: func(ts *testSyncer) *core.ConfigMap {
+				src := newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"})
+				ts.stamp(t, src, alice)
+				src.Annotations[ConfigSyncKey] = "app=demo"
+				return src
+			},
+			wantErr: "not stamped",
+		},
+		{
+			name: "stamp copied from another namespace",
+			src: func(ts *testSyncer) *core.ConfigMap {
+				src := newConfigMap("team", "omni", map[string]string{ConfigSyncKey: "true"})
+				ts.stamp(t, src, alice)
+				src.Namespace = "demo"
+				return src
+			},
+			wantErr: "not stamped",
+		},
+		{
+			name: "namespace not covered",
+			src: func(ts *testSyncer) *core.ConfigMap {
+				src := newConfigMap("open", "omni", map[string]string{ConfigSyncKey: "true"})
+				ts.stamp(t, src, alice)
+				return src
+			},
+			wantErr: "in namespace open are not stamped",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := newTestSyncer(t, Options{AuthorizeSyncs: true, RequesterKey: testRequesterKey},
+				newNamespace("demo", map[string]string{"tenant": "true"}, nil),
+				newNamespace("team", map[string]string{"tenant": "true"}, nil),
+				newNamespace("open", nil, nil),
+			)
+			ts.reloadRequesterWebhooks([]admissionregistrationv1.MutatingWebhookConfiguration{*newRequesterWebhook(covered, "configmaps", "secrets")})
+
+			user, err := ts.verifiedRequesterOf(ts.resourceFor(ConfigMaps.GroupVersionResource), c.src(ts))
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("verifiedRequesterOf() = %v, want error containing %q", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Username != "alice" {
+				t.Errorf("requester = %s, want alice", user.Username)
+			}
+		})
+	}
+}
+
+func TestRequesterWebhooks(t *testing.T) {
+	ts := newTestSyncer(t, Options{AuthorizeSyncs: true, RequesterKey: testRequesterKey},
+		newNamespace("demo", nil, nil),
+		newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"}),
+		newConfigMap("demo", "plain", nil),
+	)
+	if err := ts.LoadRequesterWebhooks(); err == nil {
+		t.Error("LoadRequesterWebhooks() accepted a cluster without the webhook")
+	}
+	if _, err := ts.kc.AdmissionregistrationV1().MutatingWebhookConfigurations().Create(context.TODO(), newRequesterWebhook(nil, "configmaps"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.LoadRequesterWebhooks(); err == nil || !strings.Contains(err.Error(), "secrets are not created and updated") {
+		t.Errorf("LoadRequesterWebhooks() = %v, want secrets to be reported", err)
+	}
+
+	// the informer reloads the webhooks and resyncs the sources synced via annotations
+	ts.leading = true
+	r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+	ts.reloadRequesterWebhooks([]admissionregistrationv1.MutatingWebhookConfiguration{*newRequesterWebhook(nil, "configmaps", "secrets")})
+	if len(ts.requesterWebhooks[Secrets.GroupVersionResource]) != 1 {
+		t.Errorf("webhooks = %v, want secrets to be covered", ts.requesterWebhooks)
+	}
+	if n := r.queue.GetQueue().Len(); n != 1 {
+		t.Errorf("%d configmaps enqueued, want 1", n)
+	}
+	r.queue.GetQueue().Get()
+
+	// unchanged webhooks don't resync the sources
+	ts.reloadRequesterWebhooks([]admissionregistrationv1.MutatingWebhookConfiguration{*newRequesterWebhook(nil, "configmaps", "secrets")})
+	if n := r.queue.GetQueue().Len(); n != 0 {
+		t.Errorf("%d configmaps enqueued, want none", n)
+	}
+
+	// a removed webhook refuses the sources again
+	ts.reloadRequesterWebhooks(nil)
+	if len(ts.requesterWebhooks) != 0 {
+		t.Errorf("webhooks = %v, want none", ts.requesterWebhooks)
+	}
+}
+
+func TestAuthorizeChecksEveryVerb(t *testing.T) {
+	ts := newTestSyncer(t, Options{AuthorizeSyncs: true, RequesterKey: testRequesterKey}, newNamespace("demo", nil, nil))
+	ts.reloadRequesterWebhooks([]admissionregistrationv1.MutatingWebhookConfiguration{*newRequesterWebhook(nil, "configmaps", "secrets")})
+	src := newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"})
+	ts.stamp(t, src, authenticationv1.UserInfo{Username: "alice"})
+
+	var verbs []string
+	ts.kc.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		verb := review.Spec.ResourceAttributes.Verb
+		verbs = append(verbs, verb)
+		review.Status.Allowed = verb != "delete"
+		return true, review, nil
+	})
+
+	reason, err := ts.authorize(ts.resourceFor(ConfigMaps.GroupVersionResource), toUnstructured(t, src), "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"create", "update", "patch", "delete"}; !reflect.DeepEqual(verbs, want) {
+		t.Errorf("verbs = %v, want %v", verbs, want)
+	}
+	if !strings.Contains(reason, "may not delete configmaps in namespace team") {
+		t.Errorf("reason = %q, want delete to be refused", reason)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+const (
+	// Secrets with this label in the cluster secret namespace register remote clusters
+	ClusterSecretLabelKey   = "kubed.appscode.com/secret-type"
+	ClusterSecretLabelValue = "cluster"
+
+	// A cluster Secret either holds a kubeconfig, whose contexts are all registered,
+	ClusterSecretKubeConfigKey = "kubeconfig"
+	// or the server address and credentials of a single cluster. The context is named
+	// after the name key, or after the Secret if the name key is not set.
+	ClusterSecretNameKey      = "name"
+	ClusterSecretServerKey    = "server"
+	ClusterSecretCAKey        = "ca.crt"
+	ClusterSecretTokenKey     = "token"
+	ClusterSecretNamespaceKey = "namespace"
+)
+
+func (s *ConfigSyncer) SetupClusterSecretInformer(informer cache.SharedIndexInformer) {
+	s.clusterIndexer = informer.GetIndexer()
+	informer.AddEventHandler(queue.NewEventHandler(s.clusterQueue.GetQueue(), func(oldObj, newObj interface{}) bool {
+		oldRes, ok := oldObj.(*core.Secret)
+		if !ok {
+			return false
+		}
+		newRes, ok := newObj.(*core.Secret)
+		if !ok {
+			return false
+		}
+		return !reflect.DeepEqual(oldRes.Labels, newRes.Labels) ||
+			!reflect.DeepEqual(oldRes.Data, newRes.Data)
+	}, core.NamespaceAll))
+}
+
+func (s *ConfigSyncer) reconcileClusterSecret(key string) error {
+	obj, exists, err := s.clusterIndexer.GetByKey(key)
+	if err != nil {
+		return err
+	}
+
+	var contexts map[string]clusterContext
+	if exists {
+		secret := obj.(*core.Secret)
+		contexts, err = contextsFromSecret(secret)
+		if err != nil {
+			s.recorder.Eventf(secret, core.EventTypeWarning, eventer.EventReasonInvalidCluster, "Failed to register cluster: %v", err)
+		}
+	} else {
+		klog.V(4).Infof("cluster secret %s does not exist anymore", key)
+	}
+
+	s.lock.Lock()
+	if len(contexts) > 0 {
+		s.secretContexts[key] = contexts
+	} else {
+		delete(s.secretContexts, key)
+	}
+	changed := s.rebuildContexts()
+	s.lock.Unlock()
+
+	if changed.Len() > 0 {
+		klog.Infof("contexts %v changed by cluster secret %s", changed.List(), key)
+		s.enqueueSourcesForContexts(changed)
+	}
+	return nil
+}
+
+func contextsFromSecret(secret *core.Secret) (map[string]clusterContext, error) {
+	if data, ok := secret.Data[ClusterSecretKubeConfigKey]; ok {
+		kConfig, err := clientcmd.Load(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid kubeconfig")
+		}
+		if err = validateInlineConfig(kConfig); err != nil {
+			return nil, err
+		}
+		contexts := contextsFromConfig(kConfig)
+		if len(contexts) == 0 {
+			return nil, errors.New("kubeconfig has no valid context")
+		}
+		return contexts, nil
+	}
+
+	server := string(secret.Data[ClusterSecretServerKey])
+	if server == "" {
+		return nil, errors.Errorf("missing %s or %s key", ClusterSecretKubeConfigKey, ClusterSecretServerKey)
+	}
+	cfg := &rest.Config{
+		Host:        server,
+		BearerToken: string(secret.Data[ClusterSecretTokenKey]),
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData: secret.Data[ClusterSecretCAKey],
+		},
+	}
+	ctx, err := newClusterContext(cfg, string(secret.Data[ClusterSecretNamespaceKey]), []interface{}{secret.Data})
+	if err != nil {
+		return nil, err
+	}
+
+	name := string(secret.Data[ClusterSecretNameKey])
+	if name == "" {
+		name = secret.Name
+	}
+	ctx.Cluster = name
+	return map[string]clusterContext{name: ctx}, nil
+}
+
+// validateInlineConfig rejects kubeconfigs that run commands or read files in the operator pod. Anyone
+// who can write a cluster Secret could otherwise run code as the operator, or send its service account
+// token to a server of their choice. Only inline data can be used in cluster Secrets.
+func validateInlineConfig(kConfig *clientcmdapi.Config) error {
+	for name, c := range kConfig.Clusters {
+		if c.CertificateAuthority != "" {
+			return errors.Errorf("cluster %s: certificate-authority files are not allowed, use certificate-authority-data", name)
+		}
+	}
+	for name, a := range kConfig.AuthInfos {
+		switch {
+		case a.Exec != nil:
+			return errors.Errorf("user %s: exec plugins are not allowed", name)
+		case a.AuthProvider != nil:
+			return errors.Errorf("user %s: auth providers are not allowed", name)
+		case a.TokenFile != "":
+			return errors.Errorf("user %s: token files are not allowed, use token", name)
+		case a.ClientCertificate != "" || a.ClientKey != "":
+			return errors.Errorf("user %s: client certificate and key files are not allowed, use client-certificate-data and client-key-data", name)
+		}
+	}
+	return nil
+}
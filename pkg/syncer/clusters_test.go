@@ -0,0 +1,234 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestValidateInlineConfig(t *testing.T) {
+	cases := []struct {
+		name    string
+		cluster *clientcmdapi.Cluster
+		user    *clientcmdapi.AuthInfo
+		wantErr string
+	}{
+		{
+			name:    "inline data",
+			cluster: &clientcmdapi.Cluster{Server: "https://remote:6443", CertificateAuthorityData: []byte("ca")},
+			user:    &clientcmdapi.AuthInfo{Token: "token", ClientCertificateData: []byte("crt"), ClientKeyData: []byte("key")},
+		},
+		{
+			name:    "certificate authority file",
+			cluster: &clientcmdapi.Cluster{Server: "https://remote:6443", CertificateAuthority: "/var/run/secrets/ca.crt"},
+			user:    &clientcmdapi.AuthInfo{Token: "token"},
+			wantErr: "certificate-authority files are not allowed",
+		},
+		{
+			name:    "exec plugin",
+			cluster: &clientcmdapi.Cluster{Server: "https://remote:6443"},
+			user:    &clientcmdapi.AuthInfo{Exec: &clientcmdapi.ExecConfig{Command: "sh"}},
+			wantErr: "exec plugins are not allowed",
+		},
+		{
+			name:    "auth provider",
+			cluster: &clientcmdapi.Cluster{Server: "https://remote:6443"},
+			user:    &clientcmdapi.AuthInfo{AuthProvider: &clientcmdapi.AuthProviderConfig{Name: "gcp"}},
+			wantErr: "auth providers are not allowed",
+		},
+		{
+			name:    "token file",
+			cluster: &clientcmdapi.Cluster{Server: "https://remote:6443"},
+			user:    &clientcmdapi.AuthInfo{TokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token"},
+			wantErr: "token files are not allowed",
+		},
+		{
+			name:    "client key file",
+			cluster: &clientcmdapi.Cluster{Server: "https://remote:6443"},
+			user:    &clientcmdapi.AuthInfo{ClientKey: "/etc/key"},
+			wantErr: "client certificate and key files are not allowed",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kConfig := clientcmdapi.NewConfig()
+			kConfig.Clusters["remote"] = c.cluster
+			kConfig.AuthInfos["remote"] = c.user
+			err := validateInlineConfig(kConfig)
+			if c.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateInlineConfig() = %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("validateInlineConfig() = %v, want %q", err, c.wantErr)
+			}
+		})
+	}
+}
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: remote
+  cluster:
+    server: https://remote.example.com
+contexts:
+- name: kind-remote
+  context:
+    cluster: remote
+    user: remote
+    namespace: team
+users:
+- name: remote
+  user:
+    %s
+`
+
+func TestContextsFromSecret(t *testing.T) {
+	newSecret := func(data map[string]string) *core.Secret {
+		secret := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster-a", Namespace: "kube-system"},
+			Data:       map[string][]byte{},
+		}
+		for k, v := range data {
+			secret.Data[k] = []byte(v)
+		}
+		return secret
+	}
+
+	cases := []struct {
+		name      string
+		data      map[string]string
+		wantName  string
+		wantNs    string
+		wantAddr  string
+		wantError string
+	}{
+		{
+			name:     "server and token",
+			data:     map[string]string{ClusterSecretServerKey: "https://10.0.0.1:6443", ClusterSecretTokenKey: "token"},
+			wantName: "cluster-a",
+			wantAddr: "10.0.0.1:6443",
+		},
+		{
+			name: "named context with namespace",
+			data: map[string]string{
+				ClusterSecretServerKey:    "https://remote.example.com",
+				ClusterSecretNameKey:      "prod",
+				ClusterSecretNamespaceKey: "team",
+			},
+			wantName: "prod",
+			wantNs:   "team",
+			wantAddr: "remote.example.com:443",
+		},
+		{
+			name:     "kubeconfig",
+			data:     map[string]string{ClusterSecretKubeConfigKey: strings.Replace(testKubeConfig, "%s", "token: abc", 1)},
+			wantName: "kind-remote",
+			wantNs:   "team",
+			wantAddr: "remote.example.com:443",
+		},
+		{
+			name:      "kubeconfig with exec plugin",
+			data:      map[string]string{ClusterSecretKubeConfigKey: strings.Replace(testKubeConfig, "%s", "exec: {apiVersion: client.authentication.k8s.io/v1, command: sh}", 1)},
+			wantError: "exec plugins are not allowed",
+		},
+		{
+			name:      "invalid kubeconfig",
+			data:      map[string]string{ClusterSecretKubeConfigKey: "{"},
+			wantError: "invalid kubeconfig",
+		},
+		{
+			name:      "missing server",
+			data:      map[string]string{ClusterSecretTokenKey: "token"},
+			wantError: "missing kubeconfig or server key",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			contexts, err := contextsFromSecret(newSecret(c.data))
+			if c.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantError) {
+					t.Fatalf("contextsFromSecret() = %v, want %q", err, c.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(contexts) != 1 {
+				t.Fatalf("contextsFromSecret() returned %d contexts, want 1", len(contexts))
+			}
+			ctx, found := contexts[c.wantName]
+			if !found {
+				t.Fatalf("context %s not found", c.wantName)
+			}
+			if ctx.Namespace != c.wantNs || ctx.Address != c.wantAddr {
+				t.Errorf("context = {Namespace: %s, Address: %s}, want {Namespace: %s, Address: %s}", ctx.Namespace, ctx.Address, c.wantNs, c.wantAddr)
+			}
+		})
+	}
+}
+
+func TestReconcileClusterSecretOnStandby(t *testing.T) {
+	src := newConfigMap("demo", "omni", map[string]string{ConfigSyncContexts: "remote"})
+	ts := newTestSyncer(t, Options{}, newNamespace("demo", nil, nil), src)
+	secret := &core.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "remote",
+			Namespace: "kube-system",
+			Labels:    map[string]string{ClusterSecretLabelKey: ClusterSecretLabelValue},
+		},
+		Data: map[string][]byte{ClusterSecretServerKey: []byte("https://remote.example.com")},
+	}
+	if err := ts.clusterIndexer.Add(secret); err != nil {
+		t.Fatal(err)
+	}
+	r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+
+	// standby replicas register the context, but leave syncing to the leader
+	if err := ts.reconcileClusterSecret("kube-system/remote"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := ts.contexts["remote"]; !found {
+		t.Errorf("context remote was not registered on a standby replica")
+	}
+	if n := r.queue.GetQueue().Len(); n != 0 {
+		t.Errorf("%d sources were enqueued on a standby replica", n)
+	}
+
+	ts.lock.Lock()
+	ts.leading = true
+	ts.lock.Unlock()
+	if err := ts.clusterIndexer.Delete(secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.reconcileClusterSecret("kube-system/remote"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := ts.contexts["remote"]; found {
+		t.Errorf("context remote is still registered after its secret was deleted")
+	}
+	if n := r.queue.GetQueue().Len(); n != 1 {
+		t.Errorf("%d sources were enqueued by the leader, want 1", n)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// AdoptLabelKey marks an existing object that may be replaced by a copy under the adopt-if-labelled conflict policy.
+const AdoptLabelKey = "kubed.appscode.com/adopt"
+
+// ValidateConflictPolicy returns an error if p is not a known conflict policy.
+func ValidateConflictPolicy(p api.ConflictPolicy) error {
+	switch p {
+	case api.ConflictPolicyOverwrite, api.ConflictPolicySkip, api.ConflictPolicyAdoptIfLabelled:
+		return nil
+	}
+	return errors.Errorf("invalid conflict policy %q, expected one of %s, %s or %s", p,
+		api.ConflictPolicyOverwrite, api.ConflictPolicySkip, api.ConflictPolicyAdoptIfLabelled)
+}
+
+// conflicts returns true if obj exists in the target, is not a copy of the source with the origin labels
+// and may not be replaced under policy p. Copies of other sources, for example another source using the
+// same target name, are conflicts too.
+func conflicts(obj *unstructured.Unstructured, origin labels.Set, p api.ConflictPolicy) bool {
+	if obj.GetResourceVersion() == "" {
+		// object is being created
+		return false
+	}
+	lbls := obj.GetLabels()
+	managed := true
+	for k, v := range origin {
+		if lbls[k] != v {
+			managed = false
+			break
+		}
+	}
+	if managed {
+		return false
+	}
+	switch p {
+	case api.ConflictPolicySkip:
+		return true
+	case api.ConflictPolicyAdoptIfLabelled:
+		return obj.GetLabels()[AdoptLabelKey] != "true"
+	}
+	return false
+}
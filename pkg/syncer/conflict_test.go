@@ -0,0 +1,130 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestValidateConflictPolicy(t *testing.T) {
+	cases := []struct {
+		policy  api.ConflictPolicy
+		wantErr bool
+	}{
+		{policy: api.ConflictPolicyOverwrite},
+		{policy: api.ConflictPolicySkip},
+		{policy: api.ConflictPolicyAdoptIfLabelled},
+		{policy: "", wantErr: true},
+		{policy: "Replace", wantErr: true},
+	}
+	for _, c := range cases {
+		if err := ValidateConflictPolicy(c.policy); (err != nil) != c.wantErr {
+			t.Errorf("ValidateConflictPolicy(%q) error = %v, wantErr %v", c.policy, err, c.wantErr)
+		}
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	origin := map[string]string{
+		OriginNameLabelKey:      "omni",
+		OriginNamespaceLabelKey: "demo",
+		OriginClusterLabelKey:   testClusterName,
+	}
+	otherSource := map[string]string{
+		OriginNameLabelKey:      "omni",
+		OriginNamespaceLabelKey: "other",
+		OriginClusterLabelKey:   testClusterName,
+	}
+	otherCluster := map[string]string{
+		OriginNameLabelKey:      "omni",
+		OriginNamespaceLabelKey: "demo",
+		OriginClusterLabelKey:   "prod",
+	}
+	cases := []struct {
+		name            string
+		resourceVersion string
+		labels          map[string]string
+		policy          api.ConflictPolicy
+		want            bool
+	}{
+		{name: "new object", policy: api.ConflictPolicySkip, want: false},
+		{name: "overwrite", resourceVersion: "1", policy: api.ConflictPolicyOverwrite, want: false},
+		{name: "skip", resourceVersion: "1", policy: api.ConflictPolicySkip, want: true},
+		{name: "skip copy", resourceVersion: "1", labels: origin, policy: api.ConflictPolicySkip, want: false},
+		{name: "skip copy of other source", resourceVersion: "1", labels: otherSource, policy: api.ConflictPolicySkip, want: true},
+		{name: "skip copy from other cluster", resourceVersion: "1", labels: otherCluster, policy: api.ConflictPolicySkip, want: true},
+		{name: "skip partially labelled", resourceVersion: "1", labels: map[string]string{OriginNameLabelKey: "omni"}, policy: api.ConflictPolicySkip, want: true},
+		{name: "overwrite copy of other source", resourceVersion: "1", labels: otherSource, policy: api.ConflictPolicyOverwrite, want: false},
+		{name: "adopt unlabelled", resourceVersion: "1", policy: api.ConflictPolicyAdoptIfLabelled, want: true},
+		{name: "adopt labelled", resourceVersion: "1", labels: map[string]string{AdoptLabelKey: "true"}, policy: api.ConflictPolicyAdoptIfLabelled, want: false},
+		{name: "adopt label false", resourceVersion: "1", labels: map[string]string{AdoptLabelKey: "false"}, policy: api.ConflictPolicyAdoptIfLabelled, want: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{}
+			obj.SetResourceVersion(c.resourceVersion)
+			obj.SetLabels(c.labels)
+			if got := conflicts(obj, origin, c.policy); got != c.want {
+				t.Errorf("conflicts() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSourcesWithSameTargetName(t *testing.T) {
+	annotations := map[string]string{
+		ConfigSyncKey:        "app=demo",
+		ConfigTargetName:     "shared",
+		ConfigConflictPolicy: string(api.ConflictPolicySkip),
+	}
+	second := newConfigMap("other", "second", annotations)
+	second.Data = map[string]string{"from": "second"}
+	// the copy of another source using the same target name
+	shared := newCopy("team", "shared", "demo", "first")
+	shared.ResourceVersion = "1"
+	ts := newTestSyncer(t, Options{},
+		newNamespace("other", nil, nil),
+		newNamespace("team", map[string]string{"app": "demo"}, nil),
+		second,
+		shared,
+	)
+
+	if err := ts.sync(ts.resourceFor(ConfigMaps.GroupVersionResource), toUnstructured(t, second)); err != nil {
+		t.Fatal(err)
+	}
+	u, err := ts.dc.Resource(ConfigMaps.GroupVersionResource).Namespace("team").Get(context.TODO(), "shared", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.GetLabels()[OriginNamespaceLabelKey]; got != "demo" {
+		t.Errorf("copy was taken over by the source in namespace %s", got)
+	}
+	if data, _, _ := unstructured.NestedStringMap(u.Object, "data"); data["you"] != "only" {
+		t.Errorf("copy data = %v, want the data of the first source", data)
+	}
+	if events := ts.events(); len(events) != 1 || !strings.Contains(events[0], eventer.EventReasonSyncSkipped) {
+		t.Errorf("events = %v, want a SyncSkipped event", events)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	kutil "kmodules.xyz/client-go"
+)
+
+// copyKey identifies a copy along with its source, so that a deleted copy can be restored.
+func copyKey(srcNamespace, srcName, namespace, name string) string {
+	return strings.Join([]string{srcNamespace, srcName, namespace, name}, "/")
+}
+
+func splitCopyKey(key string) (srcNamespace, srcName, namespace, name string, ok bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 4 {
+		return "", "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], parts[3], true
+}
+
+// enqueueCopy enqueues a copy in the source cluster for drift detection. Copies from other clusters are ignored.
+func (s *ConfigSyncer) enqueueCopy(r *resourceSyncer, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	lbls := u.GetLabels()
+	if lbls[OriginClusterLabelKey] != s.clusterName {
+		return
+	}
+	r.copyQueue.GetQueue().Add(copyKey(lbls[OriginNamespaceLabelKey], lbls[OriginNameLabelKey], u.GetNamespace(), u.GetName()))
+}
+
+func (s *ConfigSyncer) copyEventHandler(r *resourceSyncer) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldRes, ok := oldObj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			newRes, ok := newObj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			if r.Strategy.Changed(oldRes, newRes) && !s.patchedByOperator(r, oldRes, newRes) {
+				s.enqueueCopy(r, newObj)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			s.enqueueCopy(r, obj)
+		},
+	}
+}
+
+// patchedByOperator returns true if an update of a copy was made by the operator itself: the copy is
+// made from the cached version of its source, and no other field manager changed it.
+func (s *ConfigSyncer) patchedByOperator(r *resourceSyncer, old, nu *unstructured.Unstructured) bool {
+	var ref core.ObjectReference
+	if err := json.Unmarshal([]byte(nu.GetAnnotations()[ConfigOriginKey]), &ref); err != nil {
+		return false
+	}
+	obj, exists, err := r.indexer.GetByKey(ref.Namespace + "/" + ref.Name)
+	if err != nil || !exists || obj.(*unstructured.Unstructured).GetResourceVersion() != ref.ResourceVersion {
+		return false
+	}
+	return reflect.DeepEqual(managedFieldsOfOthers(old), managedFieldsOfOthers(nu))
+}
+
+// managedFieldsOfOthers returns the managed fields entries of obj that do not belong to the operator.
+func managedFieldsOfOthers(obj *unstructured.Unstructured) []metav1.ManagedFieldsEntry {
+	var out []metav1.ManagedFieldsEntry
+	for _, e := range obj.GetManagedFields() {
+		if e.Manager != FieldManager {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// reconcileCopy restores a copy in the source cluster that was modified or deleted.
+func (s *ConfigSyncer) reconcileCopy(r *resourceSyncer, key string) error {
+	srcNamespace, srcName, namespace, name, ok := splitCopyKey(key)
+	if !ok {
+		klog.Errorf("invalid copy key %s", key)
+		return nil
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	obj, exists, err := r.indexer.GetByKey(srcNamespace + "/" + srcName)
+	if err != nil {
+		return err
+	}
+	if !exists || isSyncStatus(obj.(*unstructured.Unstructured)) {
+		return nil
+	}
+	if obj.(*unstructured.Unstructured).GetDeletionTimestamp() != nil {
+		// copies of a deleted source are being removed
+		return nil
+	}
+	src := obj.(*unstructured.Unstructured).DeepCopy()
+
+	ns, err := s.getNamespace(namespace)
+	if kerr.IsNotFound(err) || (err == nil && ns.Status.Phase == core.NamespaceTerminating) {
+		// copies are removed along with the namespace
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	cur, exists, err := r.copyIndexer.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return err
+	}
+	ref := &unstructured.Unstructured{}
+	ref.SetGroupVersionKind(r.GroupVersionKind())
+	ref.SetNamespace(namespace)
+	ref.SetName(name)
+	if exists {
+		ref = cur.(*unstructured.Unstructured)
+		if isUnmanaged(ref) {
+			return nil
+		}
+		if r.Group == core.GroupName && r.Kind == "Secret" && ref.Object["type"] != src.Object["type"] {
+			// the type of a Secret is immutable, the copy is recreated once it is gone
+			err := s.dynamicClient.Resource(r.GroupVersionResource).Namespace(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{DryRun: s.dryRunOpts()})
+			if err == nil {
+				s.recordDriftCorrected(ref, src, "Deleted copy with type %v to recreate it", ref.Object["type"])
+			}
+			return err
+		}
+	}
+
+	verb, err := s.syncIntoNamespace(r, src, ns)
+	if err != nil {
+		return err
+	}
+	switch verb {
+	case kutil.VerbCreated:
+		s.recordDriftCorrected(ref, src, "Recreated copy")
+	case kutil.VerbPatched:
+		s.recordDriftCorrected(ref, src, "Restored copy")
+	}
+	return nil
+}
+
+func (s *ConfigSyncer) recordDriftCorrected(cp *unstructured.Unstructured, src *unstructured.Unstructured, format string, args ...interface{}) {
+	driftCorrections.WithLabelValues(src.GetKind(), src.GetNamespace()).Inc()
+	if s.dryRun {
+		s.logPlan("drift corrected", src, "", cp.GetNamespace())
+		return
+	}
+	s.recorder.Eventf(cp, core.EventTypeNormal, eventer.EventReasonDriftCorrected, format+" from %s %s/%s", append(args, src.GetKind(), src.GetNamespace(), src.GetName())...)
+}
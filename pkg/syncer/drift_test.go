@@ -0,0 +1,270 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+func originOf(t *testing.T, src *core.ConfigMap) string {
+	t.Helper()
+	ref, err := json.Marshal(core.ObjectReference{
+		APIVersion:      "v1",
+		Kind:            "ConfigMap",
+		Name:            src.Name,
+		Namespace:       src.Namespace,
+		UID:             src.UID,
+		ResourceVersion: src.ResourceVersion,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ref)
+}
+
+// withCopyIndexer caches copies the way the informer of copies would.
+func (ts *testSyncer) withCopyIndexer(t *testing.T, r *resourceSyncer, copies ...*core.ConfigMap) {
+	t.Helper()
+	r.copyIndexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, c := range copies {
+		if err := r.copyIndexer.Add(toUnstructured(t, c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCopyEventHandler(t *testing.T) {
+	src := newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"})
+	src.ResourceVersion = "5"
+	ts := newTestSyncer(t, Options{}, newNamespace("demo", nil, nil), src)
+	r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+
+	copyOf := func(srcVersion string, managers ...metav1.ManagedFieldsEntry) *unstructured.Unstructured {
+		c := newCopy("team", "omni", "demo", "omni")
+		s := src.DeepCopy()
+		s.ResourceVersion = srcVersion
+		c.Annotations = map[string]string{ConfigOriginKey: originOf(t, s)}
+		c.ManagedFields = managers
+		return toUnstructured(t, c)
+	}
+	operator := metav1.ManagedFieldsEntry{Manager: FieldManager, Operation: metav1.ManagedFieldsOperationUpdate, Time: &metav1.Time{}}
+	kubectl := metav1.ManagedFieldsEntry{Manager: "kubectl-edit", Operation: metav1.ManagedFieldsOperationUpdate, Time: &metav1.Time{}}
+
+	changeData := func(u *unstructured.Unstructured) *unstructured.Unstructured {
+		u.Object["data"] = map[string]interface{}{"you": "twice"}
+		return u
+	}
+
+	cases := []struct {
+		name    string
+		old     *unstructured.Unstructured
+		nu      *unstructured.Unstructured
+		enqueue bool
+	}{
+		{
+			name: "operator synced the cached version of the source",
+			old:  copyOf("4", operator),
+			nu:   changeData(copyOf("5", operator)),
+		},
+		{
+			name:    "copy made from another version of the source",
+			old:     copyOf("3", operator),
+			nu:      changeData(copyOf("4", operator)),
+			enqueue: true,
+		},
+		{
+			name:    "user edited the copy",
+			old:     copyOf("5", operator),
+			nu:      changeData(copyOf("5", operator, kubectl)),
+			enqueue: true,
+		},
+		{
+			name:    "copy without origin",
+			old:     copyOf("5", operator),
+			nu:      changeData(toUnstructured(t, newCopy("team", "omni", "demo", "omni"))),
+			enqueue: true,
+		},
+		{
+			name: "synced fields unchanged",
+			old:  copyOf("5", operator),
+			nu:   copyOf("5", operator, kubectl),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := r.copyQueue.GetQueue()
+			for q.Len() > 0 {
+				key, _ := q.Get()
+				q.Done(key)
+			}
+			ts.copyEventHandler(r).OnUpdate(c.old, c.nu)
+			if got := q.Len() > 0; got != c.enqueue {
+				t.Errorf("enqueued = %v, want %v", got, c.enqueue)
+			}
+		})
+	}
+}
+
+func TestReconcileCopy(t *testing.T) {
+	terminating := newNamespace("gone", nil, nil)
+	terminating.Status.Phase = core.NamespaceTerminating
+
+	cases := []struct {
+		name      string
+		src       func(src *core.ConfigMap)
+		copy      func(c *core.ConfigMap) *core.ConfigMap
+		namespace string
+		wantData  map[string]interface{}
+		wantEvent string
+	}{
+		{
+			name: "modified copy",
+			copy: func(c *core.ConfigMap) *core.ConfigMap {
+				c.Data = map[string]string{"you": "edited"}
+				return c
+			},
+			wantData:  map[string]interface{}{"you": "only", "live": "once"},
+			wantEvent: "Restored copy from ConfigMap demo/omni",
+		},
+		{
+			name:      "deleted copy",
+			wantData:  map[string]interface{}{"you": "only", "live": "once"},
+			wantEvent: "Recreated copy from ConfigMap demo/omni",
+		},
+		{
+			name: "unmanaged copy",
+			copy: func(c *core.ConfigMap) *core.ConfigMap {
+				c.Annotations = map[string]string{UnmanagedKey: "true"}
+				c.Data = map[string]string{"you": "edited"}
+				return c
+			},
+			wantData: map[string]interface{}{"you": "edited"},
+		},
+		{
+			name: "source being deleted",
+			src: func(src *core.ConfigMap) {
+				now := metav1.Now()
+				src.DeletionTimestamp = &now
+			},
+		},
+		{
+			name:      "namespace being deleted",
+			namespace: "gone",
+		},
+		{
+			name: "source no longer selects the namespace",
+			src: func(src *core.ConfigMap) {
+				src.Annotations[ConfigSyncKey] = "app=other"
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			namespace := c.namespace
+			if namespace == "" {
+				namespace = "team"
+			}
+			src := newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"})
+			if c.src != nil {
+				c.src(src)
+			}
+			objs := []runtime.Object{newNamespace("demo", nil, nil), newNamespace("team", nil, nil), terminating, src}
+			var copies []*core.ConfigMap
+			if c.copy != nil {
+				cp := c.copy(newCopy(namespace, "omni", "demo", "omni"))
+				objs = append(objs, cp)
+				copies = append(copies, cp)
+			}
+			ts := newTestSyncer(t, Options{}, objs...)
+			r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+			ts.withCopyIndexer(t, r, copies...)
+
+			if err := ts.reconcileCopy(r, copyKey("demo", "omni", namespace, "omni")); err != nil {
+				t.Fatal(err)
+			}
+			u, err := ts.dc.Resource(ConfigMaps.GroupVersionResource).Namespace(namespace).Get(context.TODO(), "omni", metav1.GetOptions{})
+			if c.wantData == nil {
+				if !kerr.IsNotFound(err) && c.copy == nil {
+					t.Errorf("copy was created: %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if data := u.Object["data"]; !equalData(data, c.wantData) {
+				t.Errorf("data = %v, want %v", data, c.wantData)
+			}
+
+			var found bool
+			for _, e := range ts.events() {
+				if c.wantEvent != "" && strings.Contains(e, c.wantEvent) {
+					found = true
+				} else if strings.Contains(e, "DriftCorrected") {
+					t.Errorf("unexpected event %s", e)
+				}
+			}
+			if c.wantEvent != "" && !found {
+				t.Errorf("event %q was not recorded", c.wantEvent)
+			}
+		})
+	}
+}
+
+func TestReconcileCopyOfSecretWithOtherType(t *testing.T) {
+	src := &core.Secret{Type: core.SecretTypeOpaque, Data: map[string][]byte{"token": []byte("abc")}}
+	src.Name = "creds"
+	src.Namespace = "demo"
+	src.Annotations = map[string]string{ConfigSyncKey: "true"}
+	cp := &core.Secret{Type: core.SecretTypeBasicAuth, Data: map[string][]byte{"username": []byte("a")}}
+	cp.Name = "creds"
+	cp.Namespace = "team"
+	cp.Labels = newCopy("team", "creds", "demo", "creds").Labels
+	ts := newTestSyncer(t, Options{}, newNamespace("demo", nil, nil), newNamespace("team", nil, nil), src, cp)
+	r := ts.resourceFor(Secrets.GroupVersionResource)
+	r.copyIndexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := r.copyIndexer.Add(toUnstructured(t, cp)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ts.reconcileCopy(r, copyKey("demo", "creds", "team", "creds")); err != nil {
+		t.Fatal(err)
+	}
+	// the copy is recreated with the type of the source once its deletion is observed
+	if _, err := ts.dc.Resource(Secrets.GroupVersionResource).Namespace("team").Get(context.TODO(), "creds", metav1.GetOptions{}); !kerr.IsNotFound(err) {
+		t.Errorf("copy with another type was not deleted: %v", err)
+	}
+}
+
+func equalData(got interface{}, want map[string]interface{}) bool {
+	m, ok := got.(map[string]interface{})
+	if !ok || len(m) != len(want) {
+		return false
+	}
+	for k, v := range want {
+		if m[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// SyncFinalizer blocks the deletion of a source until all of its copies are deleted.
+const SyncFinalizer = "kubed.appscode.com/config-syncer"
+
+// needsFinalizer returns true if src has sync annotations. Copies keep the sync annotations of
+// their previous version, so they never get the finalizer.
+func needsFinalizer(src metav1.Object) bool {
+	return !isCopy(src) && hasSyncAnnotations(src)
+}
+
+// hasSyncAnnotations returns true if obj is synced via annotations.
+func hasSyncAnnotations(obj metav1.Object) bool {
+	annotations := obj.GetAnnotations()
+	_, synced := annotations[ConfigSyncKey]
+	_, contexts := annotations[ConfigSyncContexts]
+	return synced || contexts
+}
+
+func hasFinalizer(src metav1.Object) bool {
+	for _, f := range src.GetFinalizers() {
+		if f == SyncFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// otherFinalizers returns the finalizers of src except the sync finalizer.
+func otherFinalizers(src metav1.Object) []string {
+	finalizers := make([]string, 0, len(src.GetFinalizers())+1)
+	for _, f := range src.GetFinalizers() {
+		if f != SyncFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	return finalizers
+}
+
+// addFinalizer adds the sync finalizer to src if it has sync annotations and returns the updated
+// source. It is called before the copies of src are synced, so a source deleted while its first
+// sync fails or is still in progress doesn't leave copies behind. Dry runs don't add the finalizer.
+func (s *ConfigSyncer) addFinalizer(r *resourceSyncer, src *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if s.dryRun || !needsFinalizer(src) || hasFinalizer(src) {
+		return src, nil
+	}
+	return s.patchFinalizers(r, src, append(otherFinalizers(src), SyncFinalizer))
+}
+
+// removeFinalizer removes the sync finalizer from a source that lost its sync annotations. It is
+// called after the copies of src were synced, so these copies are already deleted.
+func (s *ConfigSyncer) removeFinalizer(r *resourceSyncer, src *unstructured.Unstructured) error {
+	if needsFinalizer(src) || !hasFinalizer(src) {
+		return nil
+	}
+	_, err := s.patchFinalizers(r, src, otherFinalizers(src))
+	return err
+}
+
+// finalize deletes the copies of src from the source cluster and from every remote context, and
+// removes the sync finalizer once all of them are gone. A dry run only reports the copies it would
+// delete, but still removes the finalizer, so the deletion of the source isn't blocked forever.
+func (s *ConfigSyncer) finalize(r *resourceSyncer, src *unstructured.Unstructured) error {
+	forgetManagedCopies(src.GetKind(), src.GetNamespace(), src.GetName())
+	report := newSyncReport(src.GetResourceVersion())
+	spec := &copySpec{name: src.GetName()}
+
+	var errs []error
+	if err := s.syncIntoNamespaces(r, s.dynamicClient, src, spec, sets.NewString(), true, "", report); err != nil {
+		errs = append(errs, err)
+	}
+
+	// unlike a regular sync, unhealthy contexts and failed deletes block the deletion of the source
+	names := make([]string, 0, len(s.contexts))
+	for name := range s.contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	visited := map[string]struct{}{}
+	for _, name := range names {
+		ctx := s.contexts[name]
+		if _, found := visited[ctx.Address]; found {
+			continue
+		}
+		visited[ctx.Address] = struct{}{}
+		if err := s.contextHealthy(name); err != nil {
+			s.markPending(name, r, src)
+			errs = append(errs, errors.Wrapf(err, "failed to delete copies in context %s", name))
+			continue
+		}
+		if err := s.syncIntoNamespaces(r, ctx.Dynamic, src, spec, sets.NewString(), false, name, report); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	if s.dryRun {
+		klog.InfoS("Dry run", "action", "keep copies of deleted source", "kind", src.GetKind(), "source", src.GetNamespace()+"/"+src.GetName())
+	}
+	_, err := s.patchFinalizers(r, src, otherFinalizers(src))
+	return err
+}
+
+// patchFinalizers replaces the finalizers of src. The patch carries the resource version of src,
+// so it fails with a conflict instead of dropping finalizers added concurrently by others.
+func (s *ConfigSyncer) patchFinalizers(r *resourceSyncer, src *unstructured.Unstructured, finalizers []string) (*unstructured.Unstructured, error) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": src.GetResourceVersion(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.dynamicClient.Resource(r.GroupVersionResource).Namespace(src.GetNamespace()).
+		Patch(context.TODO(), src.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+}
@@ -0,0 +1,187 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestReconcileResourceFinalizer(t *testing.T) {
+	withFinalizer := func(cm *core.ConfigMap) *core.ConfigMap {
+		cm.Finalizers = []string{"example.com/other", SyncFinalizer}
+		return cm
+	}
+
+	cases := []struct {
+		name          string
+		dryRun        bool
+		src           *core.ConfigMap
+		failCopies    bool
+		wantErr       bool
+		wantFinalizer bool
+		wantWrites    []string
+	}{
+		{
+			name:          "add before sync",
+			src:           newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"}),
+			wantFinalizer: true,
+			wantWrites: []string{
+				"patch configmaps demo/omni",
+				"create configmaps team/omni",
+				"create configmaps demo/" + syncStatusName("ConfigMap", "omni"),
+			},
+		},
+		{
+			name:          "keep when the sync fails",
+			src:           newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"}),
+			failCopies:    true,
+			wantErr:       true,
+			wantFinalizer: true,
+		},
+		{
+			name: "remove after the copies are deleted",
+			src:  withFinalizer(newConfigMap("demo", "omni", nil)),
+			wantWrites: []string{
+				"delete configmaps team/omni",
+				"delete configmaps demo/" + syncStatusName("ConfigMap", "omni"),
+				"patch configmaps demo/omni",
+			},
+		},
+		{
+			name:   "dry run adds none",
+			dryRun: true,
+			src:    newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"}),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.src.ResourceVersion = "1"
+			objs := []runtime.Object{newNamespace("demo", nil, nil), newNamespace("team", nil, nil), c.src}
+			if !needsFinalizer(c.src) {
+				cp := newCopy("team", "omni", "demo", "omni")
+				cp.ResourceVersion = "1"
+				objs = append(objs, cp)
+			}
+			ts := newTestSyncer(t, Options{DryRun: c.dryRun}, objs...)
+			if c.failCopies {
+				ts.dc.PrependReactor("create", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+					if action.GetNamespace() == "team" {
+						return true, nil, errors.New("quota exceeded")
+					}
+					return false, nil, nil
+				})
+			}
+			log := ts.recordWrites()
+
+			err := ts.reconcileResource(ts.resourceFor(ConfigMaps.GroupVersionResource), "demo/omni")
+			if (err != nil) != c.wantErr {
+				t.Fatalf("reconcileResource() = %v, want error %v", err, c.wantErr)
+			}
+			if c.wantWrites != nil && !reflect.DeepEqual(log.writes, c.wantWrites) {
+				t.Errorf("writes = %v, want %v", log.writes, c.wantWrites)
+			}
+			src, err := ts.dc.Resource(ConfigMaps.GroupVersionResource).Namespace("demo").Get(context.TODO(), "omni", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hasFinalizer(src); got != c.wantFinalizer {
+				t.Errorf("finalizers = %v, want sync finalizer %v", src.GetFinalizers(), c.wantFinalizer)
+			}
+			if c.src.Finalizers != nil && !reflect.DeepEqual(otherFinalizers(src), []string{"example.com/other"}) {
+				t.Errorf("finalizers = %v, want the other finalizers kept", src.GetFinalizers())
+			}
+		})
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	cases := []struct {
+		name         string
+		dryRun       bool
+		failDeletes  bool
+		wantErr      bool
+		wantReleased bool
+		wantCopy     bool
+	}{
+		{
+			name:         "delete copies",
+			wantReleased: true,
+		},
+		{
+			name:        "block on failed deletes",
+			failDeletes: true,
+			wantErr:     true,
+			wantCopy:    true,
+		},
+		{
+			name:         "dry run releases the source",
+			dryRun:       true,
+			wantReleased: true,
+			wantCopy:     true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			src := newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"})
+			src.ResourceVersion = "1"
+			src.Finalizers = []string{SyncFinalizer}
+			now := metav1.Now()
+			src.DeletionTimestamp = &now
+			cp := newCopy("team", "omni", "demo", "omni")
+			cp.ResourceVersion = "1"
+
+			ts := newTestSyncer(t, Options{DryRun: c.dryRun},
+				newNamespace("demo", nil, nil), newNamespace("team", nil, nil), src, cp)
+			if c.failDeletes {
+				ts.dc.PrependReactor("delete", "configmaps", func(clienttesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("connection refused")
+				})
+			}
+			ts.recordWrites()
+
+			err := ts.reconcileResource(ts.resourceFor(ConfigMaps.GroupVersionResource), "demo/omni")
+			if (err != nil) != c.wantErr {
+				t.Fatalf("reconcileResource() = %v, want error %v", err, c.wantErr)
+			}
+
+			dc := ts.dc.Resource(ConfigMaps.GroupVersionResource)
+			got, err := dc.Namespace("demo").Get(context.TODO(), "omni", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if released := !hasFinalizer(got); released != c.wantReleased {
+				t.Errorf("finalizers = %v, want released %v", got.GetFinalizers(), c.wantReleased)
+			}
+			_, err = dc.Namespace("team").Get(context.TODO(), "omni", metav1.GetOptions{})
+			if err != nil && !kerr.IsNotFound(err) {
+				t.Fatal(err)
+			}
+			if exists := err == nil; exists != c.wantCopy {
+				t.Errorf("copy exists = %v, want %v", exists, c.wantCopy)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"sort"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+)
+
+// collectGarbage deletes the copies made from this cluster whose source no longer exists or no longer
+// selects the target, in the source cluster and in every healthy remote context.
+func (s *ConfigSyncer) collectGarbage() {
+	// work on a copy of the contexts, so that reloading them does not wait for the sweep, which would stall every sync
+	s.lock.RLock()
+	sweep := &gcSweep{
+		clusterName: s.clusterName,
+		contexts:    make(map[string]clusterContext, len(s.contexts)),
+	}
+	for name, ctx := range s.contexts {
+		sweep.contexts[name] = ctx
+	}
+	s.lock.RUnlock()
+	if sweep.clusterName == "" {
+		return
+	}
+
+	// visit each remote cluster once
+	names := make([]string, 0, len(sweep.contexts))
+	for name := range sweep.contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	visited := map[string]struct{}{}
+	var targets []string
+	for _, name := range names {
+		if _, found := visited[sweep.contexts[name].Address]; found {
+			continue
+		}
+		visited[sweep.contexts[name].Address] = struct{}{}
+		if err := s.contextHealthy(name); err != nil {
+			klog.V(4).Infof("skipping garbage collection in context %s: %v", name, err)
+			continue
+		}
+		targets = append(targets, name)
+	}
+
+	for _, r := range s.resources {
+		s.collectCopies(sweep, r, "", s.dynamicClient)
+		for _, name := range targets {
+			s.collectCopies(sweep, r, name, sweep.contexts[name].Dynamic)
+		}
+	}
+}
+
+// gcSweep is the state a garbage collection works with.
+type gcSweep struct {
+	clusterName string
+	contexts    map[string]clusterContext
+}
+
+func (s *ConfigSyncer) collectCopies(sweep *gcSweep, r *resourceSyncer, ctx string, dc dynamic.Interface) {
+	var copies []*unstructured.Unstructured
+	if ctx == "" && r.copyIndexer != nil {
+		for _, obj := range r.copyIndexer.List() {
+			u := obj.(*unstructured.Unstructured)
+			if u.GetLabels()[OriginClusterLabelKey] == sweep.clusterName {
+				copies = append(copies, u)
+			}
+		}
+	} else {
+		objs, err := dc.Resource(r.GroupVersionResource).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(map[string]string{OriginClusterLabelKey: sweep.clusterName}).String(),
+		})
+		if err != nil {
+			klog.Errorf("failed to list copies of %s in context %s: %v", r.Kind, ctx, err)
+			return
+		}
+		for i := range objs.Items {
+			copies = append(copies, &objs.Items[i])
+		}
+	}
+
+	orphans := 0
+	for _, c := range copies {
+		if isUnmanaged(c) {
+			continue
+		}
+		wanted, err := s.wantsCopy(sweep, r, c, ctx)
+		if err != nil {
+			klog.Errorf("failed to check %s %s/%s in context %q: %v", r.Kind, c.GetNamespace(), c.GetName(), ctx, err)
+			continue
+		}
+		if wanted {
+			continue
+		}
+		orphans++
+		lbls := c.GetLabels()
+		klog.InfoS("Orphaned copy", "kind", r.Kind, "context", ctx, "namespace", c.GetNamespace(), "name", c.GetName(),
+			"source", lbls[OriginNamespaceLabelKey]+"/"+lbls[OriginNameLabelKey], "delete", !s.gcDryRun)
+		if s.gcDryRun {
+			continue
+		}
+		err = dc.Resource(r.GroupVersionResource).Namespace(c.GetNamespace()).Delete(context.TODO(), c.GetName(), metav1.DeleteOptions{DryRun: s.dryRunOpts()})
+		if err != nil && !kerr.IsNotFound(err) {
+			klog.Errorf("failed to delete orphaned %s %s/%s in context %q: %v", r.Kind, c.GetNamespace(), c.GetName(), ctx, err)
+			continue
+		}
+		gcDeletes.WithLabelValues(r.Kind, ctx).Inc()
+	}
+	orphanedCopies.WithLabelValues(r.Kind, ctx).Set(float64(orphans))
+}
+
+// wantsCopy returns true if the source of a copy exists and still selects the target of the copy.
+func (s *ConfigSyncer) wantsCopy(sweep *gcSweep, r *resourceSyncer, c *unstructured.Unstructured, ctx string) (bool, error) {
+	lbls := c.GetLabels()
+	src, err := s.sourceOf(r, lbls[OriginNamespaceLabelKey], lbls[OriginNameLabelKey])
+	if err != nil || src == nil || src.GetDeletionTimestamp() != nil {
+		return false, err
+	}
+
+	opts := s.syncOptionsFor(r.SourceKind(), src)
+	name := opts.TargetName
+	if name == "" {
+		name = src.GetName()
+	}
+	if c.GetName() != name || !s.policy.AllowsSource(src.GetNamespace()) || s.policy.DeniesTarget(c.GetNamespace()) {
+		return false, nil
+	}
+
+	if ctx == "" {
+		if len(opts.NamespaceSelectors) == 0 {
+			return false, nil
+		}
+		ns, err := s.getNamespace(c.GetNamespace())
+		if kerr.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if Excludes(ns, r.Kind, src) {
+			return false, nil
+		}
+		return SelectorsMatch(opts.NamespaceSelectors, ns.Labels)
+	}
+
+	// the copy may have been made via another context of the same cluster
+	address := sweep.contexts[ctx].Address
+	for _, name := range opts.Contexts.List() {
+		target, found := sweep.contexts[name]
+		if !found || target.Address != address {
+			continue
+		}
+		namespace := target.Namespace
+		if namespace == "" {
+			namespace = src.GetNamespace()
+		}
+		if namespace == c.GetNamespace() {
+			excluded, err := contextExcludes(sweep.contexts[ctx].Client, namespace, r.Kind, src)
+			return !excluded, err
+		}
+	}
+	return false, nil
+}
+
+// sourceOf returns a source from the cache, or from the API server if it is not cached. It returns nil if the source does not exist.
+func (s *ConfigSyncer) sourceOf(r *resourceSyncer, namespace, name string) (*unstructured.Unstructured, error) {
+	obj, exists, err := r.indexer.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return obj.(*unstructured.Unstructured), nil
+	}
+	// sources outside of the config source namespace are not cached
+	src, err := s.dynamicClient.Resource(r.GroupVersionResource).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		return nil, nil
+	}
+	return src, err
+}
@@ -0,0 +1,310 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newSource(annotations map[string]string) *core.ConfigMap {
+	return newConfigMap("demo", "omni", annotations)
+}
+
+func TestSourceOf(t *testing.T) {
+	ts := newTestSyncer(t, Options{}, newSource(map[string]string{ConfigSyncKey: "true"}))
+	// sources outside of the config source namespace are not cached
+	if err := ts.dc.Tracker().Add(toUnstructured(t, newConfigMap("team", "other", nil))); err != nil {
+		t.Fatal(err)
+	}
+	r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+
+	cases := []struct {
+		name      string
+		namespace string
+		srcName   string
+		wantFound bool
+	}{
+		{name: "cached", namespace: "demo", srcName: "omni", wantFound: true},
+		{name: "not cached", namespace: "team", srcName: "other", wantFound: true},
+		{name: "missing", namespace: "team", srcName: "omni", wantFound: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			src, err := ts.sourceOf(r, c.namespace, c.srcName)
+			if err != nil {
+				t.Fatalf("sourceOf() error = %v", err)
+			}
+			if (src != nil) != c.wantFound {
+				t.Fatalf("sourceOf() = %v, want found %v", src, c.wantFound)
+			}
+			if src != nil && (src.GetNamespace() != c.namespace || src.GetName() != c.srcName) {
+				t.Errorf("sourceOf() = %s/%s, want %s/%s", src.GetNamespace(), src.GetName(), c.namespace, c.srcName)
+			}
+		})
+	}
+}
+
+func TestWantsCopy(t *testing.T) {
+	terminating := newSource(map[string]string{ConfigSyncKey: "true"})
+	now := metav1.Now()
+	terminating.DeletionTimestamp = &now
+
+	cases := []struct {
+		name       string
+		src        *core.ConfigMap
+		policy     *OperatorPolicy
+		namespaces []*core.Namespace
+		remote     []runtime.Object
+		copy       *core.ConfigMap
+		ctx        string
+		want       bool
+	}{
+		{
+			name: "source deleted",
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: false,
+		},
+		{
+			name: "source terminating",
+			src:  terminating,
+			namespaces: []*core.Namespace{
+				newNamespace("team", nil, nil),
+			},
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: false,
+		},
+		{
+			name: "selected namespace",
+			src:  newSource(map[string]string{ConfigSyncKey: "app=a"}),
+			namespaces: []*core.Namespace{
+				newNamespace("team", map[string]string{"app": "a"}, nil),
+			},
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: true,
+		},
+		{
+			name: "namespace no longer selected",
+			src:  newSource(map[string]string{ConfigSyncKey: "app=a"}),
+			namespaces: []*core.Namespace{
+				newNamespace("team", map[string]string{"app": "b"}, nil),
+			},
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: false,
+		},
+		{
+			name: "sync annotation removed",
+			src:  newSource(nil),
+			namespaces: []*core.Namespace{
+				newNamespace("team", nil, nil),
+			},
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: false,
+		},
+		{
+			name: "namespace deleted",
+			src:  newSource(map[string]string{ConfigSyncKey: "true"}),
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: false,
+		},
+		{
+			name: "target name",
+			src:  newSource(map[string]string{ConfigSyncKey: "true", ConfigTargetName: "shared"}),
+			namespaces: []*core.Namespace{
+				newNamespace("team", nil, nil),
+			},
+			copy: newCopy("team", "shared", "demo", "omni"),
+			want: true,
+		},
+		{
+			name: "target name changed",
+			src:  newSource(map[string]string{ConfigSyncKey: "true", ConfigTargetName: "shared"}),
+			namespaces: []*core.Namespace{
+				newNamespace("team", nil, nil),
+			},
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: false,
+		},
+		{
+			name: "namespace opted out",
+			src:  newSource(map[string]string{ConfigSyncKey: "true"}),
+			namespaces: []*core.Namespace{
+				newNamespace("team", nil, map[string]string{NamespaceExcludeKey: "configmap/demo/omni"}),
+			},
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: false,
+		},
+		{
+			name: "namespace opted out of other kind",
+			src:  newSource(map[string]string{ConfigSyncKey: "true"}),
+			namespaces: []*core.Namespace{
+				newNamespace("team", nil, map[string]string{NamespaceExcludeKey: "secret/demo/omni"}),
+			},
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: true,
+		},
+		{
+			name:   "target denied by operator policy",
+			src:    newSource(map[string]string{ConfigSyncKey: "true"}),
+			policy: &OperatorPolicy{DeniedTargetNamespaces: []string{"te*"}},
+			namespaces: []*core.Namespace{
+				newNamespace("team", nil, nil),
+			},
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: false,
+		},
+		{
+			name:   "source not allowed by operator policy",
+			src:    newSource(map[string]string{ConfigSyncKey: "true"}),
+			policy: &OperatorPolicy{SourceNamespaces: []string{"kube-*"}},
+			namespaces: []*core.Namespace{
+				newNamespace("team", nil, nil),
+			},
+			copy: newCopy("team", "omni", "demo", "omni"),
+			want: false,
+		},
+		{
+			name: "selected context",
+			src:  newSource(map[string]string{ConfigSyncContexts: "remote"}),
+			copy: newCopy("demo", "omni", "demo", "omni"),
+			ctx:  "remote",
+			want: true,
+		},
+		{
+			name: "selected via other context of the same cluster",
+			src:  newSource(map[string]string{ConfigSyncContexts: "alias"}),
+			copy: newCopy("demo", "omni", "demo", "omni"),
+			ctx:  "remote",
+			want: true,
+		},
+		{
+			name: "context no longer selected",
+			src:  newSource(map[string]string{ConfigSyncContexts: "other"}),
+			copy: newCopy("demo", "omni", "demo", "omni"),
+			ctx:  "remote",
+			want: false,
+		},
+		{
+			name: "context namespace changed",
+			src:  newSource(map[string]string{ConfigSyncContexts: "remote"}),
+			copy: newCopy("team", "omni", "demo", "omni"),
+			ctx:  "remote",
+			want: false,
+		},
+		{
+			name: "context namespace opted out",
+			src:  newSource(map[string]string{ConfigSyncContexts: "remote"}),
+			remote: []runtime.Object{
+				newNamespace("demo", nil, map[string]string{NamespaceExcludeKey: "demo/omni"}),
+			},
+			copy: newCopy("demo", "omni", "demo", "omni"),
+			ctx:  "remote",
+			want: false,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var objs []runtime.Object
+			if c.src != nil {
+				objs = append(objs, c.src)
+			}
+			for _, ns := range c.namespaces {
+				objs = append(objs, ns)
+			}
+			ts := newTestSyncer(t, Options{Policy: c.policy}, objs...)
+			r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+			client := fake.NewSimpleClientset(c.remote...)
+			sweep := &gcSweep{
+				clusterName: testClusterName,
+				contexts: map[string]clusterContext{
+					"remote": {Client: client, Address: "https://remote"},
+					"alias":  {Client: client, Address: "https://remote"},
+					"other":  {Client: fake.NewSimpleClientset(), Address: "https://other"},
+				},
+			}
+			got, err := ts.wantsCopy(sweep, r, toUnstructured(t, c.copy), c.ctx)
+			if err != nil {
+				t.Fatalf("wantsCopy() error = %v", err)
+			}
+			if got != c.want {
+				t.Errorf("wantsCopy() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	unmanaged := newCopy("team", "gone", "demo", "gone")
+	unmanaged.Annotations = map[string]string{UnmanagedKey: "true"}
+	foreign := newCopy("team", "foreign", "demo", "foreign")
+	foreign.Labels[OriginClusterLabelKey] = "other"
+	objs := []runtime.Object{
+		newNamespace("demo", nil, nil),
+		newNamespace("team", nil, nil),
+		newSource(map[string]string{ConfigSyncKey: "true"}),
+		newCopy("team", "omni", "demo", "omni"),
+		newCopy("team", "orphan", "demo", "orphan"),
+		unmanaged,
+		foreign,
+	}
+
+	cases := []struct {
+		name       string
+		gcDryRun   bool
+		wantKept   []string
+		wantPruned []string
+	}{
+		{
+			name:       "delete orphans",
+			wantKept:   []string{"omni", "gone", "foreign"},
+			wantPruned: []string{"orphan"},
+		},
+		{
+			name:     "report orphans",
+			gcDryRun: true,
+			wantKept: []string{"omni", "gone", "foreign", "orphan"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := newTestSyncer(t, Options{GCDryRun: c.gcDryRun}, objs...)
+			log := ts.recordWrites()
+			ts.collectGarbage()
+
+			dc := ts.dc.Resource(ConfigMaps.GroupVersionResource).Namespace("team")
+			for _, name := range c.wantKept {
+				if _, err := dc.Get(context.TODO(), name, metav1.GetOptions{}); err != nil {
+					t.Errorf("copy %s was deleted: %v", name, err)
+				}
+			}
+			for _, name := range c.wantPruned {
+				if _, err := dc.Get(context.TODO(), name, metav1.GetOptions{}); !kerr.IsNotFound(err) {
+					t.Errorf("orphaned copy %s was not deleted: %v", name, err)
+				}
+			}
+			if len(log.writes) != len(c.wantPruned) || len(log.dryRuns) > 0 {
+				t.Errorf("writes = %v, dry runs = %v, want %d deletes", log.writes, log.dryRuns, len(c.wantPruned))
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const probeTimeout = 10 * time.Second
+
+// contextHealth is the circuit breaker of a remote context. The circuit opens after a number of
+// consecutive failed probes and closes on the next successful probe.
+type contextHealth struct {
+	failures int
+	open     bool
+	lastErr  error
+	// sources that were not synced into the context while the circuit was open
+	pending map[*resourceSyncer]sets.String
+}
+
+func (s *ConfigSyncer) probeContexts() {
+	s.lock.RLock()
+	contexts := make(map[string]clusterContext, len(s.contexts))
+	for name, ctx := range s.contexts {
+		contexts[name] = ctx
+	}
+	s.lock.RUnlock()
+
+	var wg sync.WaitGroup
+	for name, ctx := range contexts {
+		wg.Add(1)
+		go func(name string, ctx clusterContext) {
+			defer wg.Done()
+			s.probeContext(name, ctx)
+		}(name, ctx)
+	}
+	wg.Wait()
+}
+
+func (s *ConfigSyncer) probeContext(name string, ctx clusterContext) {
+	c, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	_, err := ctx.Client.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(c)
+	setContextReachable(name, err)
+
+	s.healthLock.Lock()
+	h := s.healthOf(name)
+	var opened, closed bool
+	var pending map[*resourceSyncer]sets.String
+	if err != nil {
+		h.failures++
+		h.lastErr = err
+		if !h.open && s.failureThreshold > 0 && h.failures >= s.failureThreshold {
+			h.open = true
+			opened = true
+		}
+	} else {
+		h.failures = 0
+		h.lastErr = nil
+		if h.open {
+			h.open = false
+			closed = true
+			pending = h.pending
+			h.pending = nil
+		}
+	}
+	s.healthLock.Unlock()
+
+	if opened {
+		klog.Warningf("context %s is unhealthy, skipping it until it recovers: %v", name, err)
+		setContextCircuitOpen(name, true)
+		s.recordContextEvent(name, core.EventTypeWarning, eventer.EventReasonContextUnhealthy, "Context %s is unhealthy, skipping it until it recovers: %v", name, err)
+	}
+	if closed {
+		klog.Infof("context %s recovered", name)
+		setContextCircuitOpen(name, false)
+		s.recordContextEvent(name, core.EventTypeNormal, eventer.EventReasonContextRecovered, "Context %s recovered", name)
+		for r, keys := range pending {
+			for _, key := range keys.List() {
+				r.queue.GetQueue().Add(key)
+			}
+		}
+	}
+}
+
+// healthOf returns the health of a context. The caller must hold the health lock.
+func (s *ConfigSyncer) healthOf(name string) *contextHealth {
+	h, found := s.health[name]
+	if !found {
+		h = &contextHealth{}
+		s.health[name] = h
+	}
+	return h
+}
+
+// contextHealthy returns an error if the circuit of the context is open.
+func (s *ConfigSyncer) contextHealthy(name string) error {
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+	if h, found := s.health[name]; found && h.open {
+		return errors.Errorf("context %s is unhealthy: %v", name, h.lastErr)
+	}
+	return nil
+}
+
+// markPending queues src to be synced again once the context recovers.
+func (s *ConfigSyncer) markPending(name string, r *resourceSyncer, src *unstructured.Unstructured) {
+	key, err := cache.MetaNamespaceKeyFunc(src)
+	if err != nil {
+		return
+	}
+
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+	h := s.healthOf(name)
+	if h.pending == nil {
+		h.pending = map[*resourceSyncer]sets.String{}
+	}
+	if h.pending[r] == nil {
+		h.pending[r] = sets.NewString()
+	}
+	h.pending[r].Insert(key)
+}
+
+// resetHealth forgets the health of contexts that were removed or modified.
+func (s *ConfigSyncer) resetHealth(names sets.String) {
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+	for _, name := range names.List() {
+		delete(s.health, name)
+	}
+}
+
+// recordContextEvent records an event on every source that is synced into the context.
+func (s *ConfigSyncer) recordContextEvent(name, eventType, reason, messageFmt string, args ...interface{}) {
+	s.forEachSourceInContexts(sets.NewString(name), func(_ *resourceSyncer, src *unstructured.Unstructured) {
+		s.recorder.Eventf(src, eventType, reason, messageFmt, args...)
+	})
+}
@@ -0,0 +1,107 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestProbeContextCircuitBreaker(t *testing.T) {
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" || atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	src := newConfigMap("demo", "omni", map[string]string{ConfigSyncContexts: "remote"})
+	ts := newTestSyncer(t, Options{FailureThreshold: 2}, newNamespace("demo", nil, nil), src)
+	ctx, err := newClusterContext(&rest.Config{Host: srv.URL}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.lock.Lock()
+	ts.fileContexts = map[string]clusterContext{"remote": ctx}
+	ts.rebuildContexts()
+	ts.lock.Unlock()
+	r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+
+	ts.probeContext("remote", ctx)
+	if err := ts.contextHealthy("remote"); err != nil {
+		t.Errorf("circuit opened after a single failure: %v", err)
+	}
+
+	ts.probeContext("remote", ctx)
+	if err := ts.contextHealthy("remote"); err == nil {
+		t.Errorf("circuit is closed after reaching the failure threshold")
+	}
+	if events := ts.events(); len(events) != 1 {
+		t.Errorf("events = %v, want one ContextUnhealthy event", events)
+	}
+
+	ts.markPending("remote", r, toUnstructured(t, src))
+	ts.probeContext("remote", ctx)
+	if events := ts.events(); len(events) != 0 {
+		t.Errorf("events = %v after the circuit was already open", events)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	ts.probeContext("remote", ctx)
+	if err := ts.contextHealthy("remote"); err != nil {
+		t.Errorf("circuit is open after a successful probe: %v", err)
+	}
+	if events := ts.events(); len(events) != 1 {
+		t.Errorf("events = %v, want one ContextRecovered event", events)
+	}
+	if n := r.queue.GetQueue().Len(); n != 1 {
+		t.Errorf("%d pending sources were requeued, want 1", n)
+	}
+
+	// a failure after recovery starts counting again
+	atomic.StoreInt32(&healthy, 0)
+	ts.probeContext("remote", ctx)
+	if err := ts.contextHealthy("remote"); err != nil {
+		t.Errorf("circuit opened after a single failure: %v", err)
+	}
+}
+
+func TestProbeContextWithoutThreshold(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ts := newTestSyncer(t, Options{})
+	ctx, err := newClusterContext(&rest.Config{Host: srv.URL}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		ts.probeContext("remote", ctx)
+	}
+	if err := ts.contextHealthy("remote"); err != nil {
+		t.Errorf("circuit opened without a failure threshold: %v", err)
+	}
+}
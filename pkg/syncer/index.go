@@ -0,0 +1,169 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	core_listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// OriginIndex indexes copies by the cluster, namespace and name of their source
+	OriginIndex = "origin"
+	// SyncAnnotationIndex indexes sources that carry the sync annotation
+	SyncAnnotationIndex = "syncAnnotation"
+	// TransformIndex indexes sources by the ConfigMap holding their transform script
+	TransformIndex = "transform"
+)
+
+func originKey(cluster, namespace, name string) string {
+	return cluster + "/" + namespace + "/" + name
+}
+
+func originIndexFunc(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	lbls := m.GetLabels()
+	name, ok := lbls[OriginNameLabelKey]
+	if !ok {
+		return nil, nil
+	}
+	return []string{originKey(lbls[OriginClusterLabelKey], lbls[OriginNamespaceLabelKey], name)}, nil
+}
+
+func syncAnnotationIndexFunc(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := m.GetAnnotations()[ConfigSyncKey]; ok {
+		return []string{"true"}, nil
+	}
+	return nil, nil
+}
+
+// SetupCopyInformer sets up the informer that caches the copies of a resource in every namespace
+// and restores copies that are modified or deleted.
+// The informer must only watch objects with the origin labels.
+func (s *ConfigSyncer) SetupCopyInformer(gvr schema.GroupVersionResource, informer cache.SharedIndexInformer) {
+	r := s.resourceFor(gvr)
+	if r == nil {
+		klog.Errorf("resource %s is not synced", gvr)
+		return
+	}
+	if err := informer.AddIndexers(cache.Indexers{OriginIndex: originIndexFunc}); err != nil {
+		klog.Errorf("failed to add origin indexer for %s: %v", gvr, err)
+		return
+	}
+	r.copyIndexer = informer.GetIndexer()
+	informer.AddEventHandler(s.copyEventHandler(r))
+}
+
+// namespacesForSelectors returns the namespaces matching any of the given selectors from the namespace cache,
+// except those that opted out of syncs of src, a source of the given kind.
+func (s *ConfigSyncer) namespacesForSelectors(kind string, selectors []string, src metav1.Object) (sets.String, error) {
+	lister := core_listers.NewNamespaceLister(s.nsIndexer)
+	ns := sets.NewString()
+	for _, selector := range selectors {
+		sel, err := labels.Parse(selector)
+		if err != nil {
+			return nil, err
+		}
+		namespaces, err := lister.List(sel)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range namespaces {
+			if !Excludes(obj, kind, src) && !s.policy.DeniesTarget(obj.Name) {
+				ns.Insert(obj.Name)
+			}
+		}
+	}
+	return ns, nil
+}
+
+// cachedCopiesOf returns the copies of src in the source cluster from the copy cache.
+func (s *ConfigSyncer) cachedCopiesOf(r *resourceSyncer, src *unstructured.Unstructured) ([]metav1.Object, error) {
+	objs, err := r.copyIndexer.ByIndex(OriginIndex, originKey(s.clusterName, src.GetNamespace(), src.GetName()))
+	if err != nil {
+		return nil, err
+	}
+	copies := make([]metav1.Object, 0, len(objs))
+	for _, obj := range objs {
+		copies = append(copies, obj.(*unstructured.Unstructured))
+	}
+	return copies, nil
+}
+
+// namespaceSyncSources returns the sources of a resource that are synced into namespaces selected by labels,
+// either via the sync annotation or via a SyncPolicy.
+func (s *ConfigSyncer) namespaceSyncSources(r *resourceSyncer) ([]*unstructured.Unstructured, error) {
+	objs, err := r.indexer.ByIndex(SyncAnnotationIndex, "true")
+	if err != nil {
+		return nil, err
+	}
+	seen := sets.NewString()
+	out := make([]*unstructured.Unstructured, 0, len(objs))
+	add := func(obj interface{}) {
+		src := obj.(*unstructured.Unstructured)
+		key := src.GetNamespace() + "/" + src.GetName()
+		if !seen.Has(key) && !isSyncStatus(src) && src.GetDeletionTimestamp() == nil {
+			seen.Insert(key)
+			out = append(out, src)
+		}
+	}
+	for _, obj := range objs {
+		add(obj)
+	}
+
+	if r.SourceKind() == "" {
+		return out, nil
+	}
+	for _, item := range s.policyIndexer.List() {
+		policy, err := toSyncPolicy(item)
+		if err != nil {
+			klog.Errorln(err)
+			continue
+		}
+		if policy.Spec.Source.Kind != r.SourceKind() || len(policy.Spec.Target.NamespaceSelectors) == 0 {
+			continue
+		}
+		sources, err := s.sourcesForSyncPolicy(policy)
+		if err != nil {
+			klog.Errorf("failed to list sources for syncpolicy %s: %v", policy.Name, err)
+			continue
+		}
+		for _, src := range sources {
+			add(src)
+		}
+	}
+	return out, nil
+}
+
+func (s *ConfigSyncer) getNamespace(name string) (*core.Namespace, error) {
+	return core_listers.NewNamespaceLister(s.nsIndexer).Get(name)
+}
@@ -0,0 +1,162 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"path"
+	"strings"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ValidateKeyFilter returns an error if any pattern of the filter is malformed,
+// or if the filter renames keys into invalid or duplicate keys.
+func ValidateKeyFilter(f api.KeyFilter) error {
+	for _, p := range append(append([]string(nil), f.Include...), f.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.Wrapf(err, "invalid key pattern %q", p)
+		}
+	}
+	renamed := map[string]string{}
+	for from, to := range f.Rename {
+		if msgs := validation.IsConfigMapKey(to); len(msgs) > 0 {
+			return errors.Errorf("invalid key %q: %s", to, strings.Join(msgs, ", "))
+		}
+		if other, ok := renamed[to]; ok {
+			return errors.Errorf("keys %q and %q are both renamed to %q", other, from, to)
+		}
+		renamed[to] = from
+	}
+	return nil
+}
+
+// keyMatches returns true if the key is selected by the filter. The patterns must be valid.
+func keyMatches(f api.KeyFilter, key string) bool {
+	matchesAny := func(patterns []string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, key); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(f.Include) > 0 && !matchesAny(f.Include) {
+		return false
+	}
+	return !matchesAny(f.Exclude)
+}
+
+// parseKeyRenames parses a comma separated list of <from>=<to> pairs.
+func parseKeyRenames(v string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, pair := range parseKeyPatterns(v) {
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || from == "" || to == "" {
+			return nil, errors.Errorf("invalid key mapping %q, expected <from>=<to>", pair)
+		}
+		out[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	return out, nil
+}
+
+func parseKeyPatterns(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// MapKeys removes the keys not selected by the filter from the key fields of obj,
+// then renames the remaining keys. Renaming a key into a key that is kept, in the same
+// or another key field, is an error, since only one of them could be copied.
+func (f FieldStrategy) MapKeys(obj *unstructured.Unstructured, filter api.KeyFilter) error {
+	if len(filter.Include) == 0 && len(filter.Exclude) == 0 && len(filter.Rename) == 0 {
+		return nil
+	}
+	if err := ValidateKeyFilter(filter); err != nil {
+		return err
+	}
+	mapped := map[string]map[string]interface{}{}
+	owners := map[string]string{} // key of the copy => field and key of the source it is copied from
+	for _, field := range f.KeyFields {
+		data, ok := obj.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		mapped[field] = make(map[string]interface{}, len(data))
+		for _, k := range sets.StringKeySet(data).List() {
+			if !keyMatches(filter, k) {
+				continue
+			}
+			to := k
+			if v, ok := filter.Rename[k]; ok {
+				to = v
+			}
+			if other, ok := owners[to]; ok {
+				return errors.Errorf("keys %s and %s.%s are both copied into key %q", other, field, k, to)
+			}
+			owners[to] = field + "." + k
+			mapped[field][to] = data[k]
+		}
+	}
+	if obj.GroupVersionKind().GroupKind() == Secrets.GroupVersionKind().GroupKind() {
+		if err := validateSecretKeys(obj, mapped["data"]); err != nil {
+			return err
+		}
+	}
+	for field, data := range mapped {
+		obj.Object[field] = data
+	}
+	return nil
+}
+
+// requiredSecretKeys lists the keys the API server requires in Secrets of a type.
+// At least one key of each list must be copied.
+var requiredSecretKeys = map[core.SecretType][][]string{
+	core.SecretTypeTLS:              {{core.TLSCertKey}, {core.TLSPrivateKeyKey}},
+	core.SecretTypeDockerConfigJson: {{core.DockerConfigJsonKey}},
+	core.SecretTypeDockercfg:        {{core.DockerConfigKey}},
+	core.SecretTypeBasicAuth:        {{core.BasicAuthUsernameKey, core.BasicAuthPasswordKey}},
+	core.SecretTypeSSHAuth:          {{core.SSHAuthPrivateKey}},
+}
+
+// validateSecretKeys returns an error if the filtered data of a Secret lacks a key required by its type.
+// Copies keep the type of their source, so the API server would reject them.
+func validateSecretKeys(secret *unstructured.Unstructured, data map[string]interface{}) error {
+	secretType, _, _ := unstructured.NestedString(secret.Object, "type")
+	for _, keys := range requiredSecretKeys[core.SecretType(secretType)] {
+		found := false
+		for _, k := range keys {
+			if _, found = data[k]; found {
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("secrets of type %s require key %s, filter the keys of an Opaque secret instead", secretType, strings.Join(keys, " or "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseKeyRenames(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", in: "", want: map[string]string{}},
+		{name: "single", in: "a=b", want: map[string]string{"a": "b"}},
+		{name: "spaces", in: " a = b , c=d ", want: map[string]string{"a": "b", "c": "d"}},
+		{name: "trailing comma", in: "a=b,", want: map[string]string{"a": "b"}},
+		{name: "missing separator", in: "a", wantErr: true},
+		{name: "missing source", in: "=b", wantErr: true},
+		{name: "missing target", in: "a=", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseKeyRenames(c.in)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("parseKeyRenames(%q) error = %v, wantErr %v", c.in, err, c.wantErr)
+			}
+			if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+				t.Errorf("parseKeyRenames(%q) = %v, want %v", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateKeyFilter(t *testing.T) {
+	cases := []struct {
+		name    string
+		filter  api.KeyFilter
+		wantErr bool
+	}{
+		{name: "empty", filter: api.KeyFilter{}},
+		{name: "patterns", filter: api.KeyFilter{Include: []string{"*.yaml"}, Exclude: []string{"secret-?"}}},
+		{name: "malformed include", filter: api.KeyFilter{Include: []string{"[a-"}}, wantErr: true},
+		{name: "malformed exclude", filter: api.KeyFilter{Exclude: []string{"[a-"}}, wantErr: true},
+		{name: "rename", filter: api.KeyFilter{Rename: map[string]string{"a": "b"}}},
+		{name: "invalid key", filter: api.KeyFilter{Rename: map[string]string{"a": "b/c"}}, wantErr: true},
+		{name: "duplicate target", filter: api.KeyFilter{Rename: map[string]string{"a": "c", "b": "c"}}, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := ValidateKeyFilter(c.filter); (err != nil) != c.wantErr {
+				t.Errorf("ValidateKeyFilter() error = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestMapKeys(t *testing.T) {
+	strategy := fieldStrategies[ConfigMaps.GroupVersionKind().GroupKind()]
+	cases := []struct {
+		name       string
+		data       map[string]interface{}
+		binaryData map[string]interface{}
+		filter     api.KeyFilter
+		want       map[string]interface{}
+		wantBinary map[string]interface{}
+		wantErr    bool
+	}{
+		{
+			name:   "no filter",
+			data:   map[string]interface{}{"a": "1", "b": "2"},
+			filter: api.KeyFilter{},
+			want:   map[string]interface{}{"a": "1", "b": "2"},
+		},
+		{
+			name:   "include",
+			data:   map[string]interface{}{"a.yaml": "1", "b.json": "2"},
+			filter: api.KeyFilter{Include: []string{"*.yaml"}},
+			want:   map[string]interface{}{"a.yaml": "1"},
+		},
+		{
+			name:   "exclude wins over include",
+			data:   map[string]interface{}{"a.yaml": "1", "b.yaml": "2"},
+			filter: api.KeyFilter{Include: []string{"*.yaml"}, Exclude: []string{"b.*"}},
+			want:   map[string]interface{}{"a.yaml": "1"},
+		},
+		{
+			name:   "rename",
+			data:   map[string]interface{}{"a": "1", "b": "2"},
+			filter: api.KeyFilter{Rename: map[string]string{"a": "c"}},
+			want:   map[string]interface{}{"c": "1", "b": "2"},
+		},
+		{
+			name:   "swap",
+			data:   map[string]interface{}{"a": "1", "b": "2"},
+			filter: api.KeyFilter{Rename: map[string]string{"a": "b", "b": "a"}},
+			want:   map[string]interface{}{"b": "1", "a": "2"},
+		},
+		{
+			name:   "rename after filter",
+			data:   map[string]interface{}{"a": "1", "b": "2"},
+			filter: api.KeyFilter{Exclude: []string{"b"}, Rename: map[string]string{"a": "b"}},
+			want:   map[string]interface{}{"b": "1"},
+		},
+		{
+			name:    "rename into kept key",
+			data:    map[string]interface{}{"a": "1", "b": "2"},
+			filter:  api.KeyFilter{Rename: map[string]string{"a": "b"}},
+			wantErr: true,
+		},
+		{
+			name:       "rename into key of other field",
+			data:       map[string]interface{}{"a": "1"},
+			binaryData: map[string]interface{}{"b": "Mg=="},
+			filter:     api.KeyFilter{Rename: map[string]string{"a": "b"}},
+			wantErr:    true,
+		},
+		{
+			name:       "rename binary data",
+			data:       map[string]interface{}{"a": "1"},
+			binaryData: map[string]interface{}{"b": "Mg=="},
+			filter:     api.KeyFilter{Rename: map[string]string{"b": "c"}},
+			want:       map[string]interface{}{"a": "1"},
+			wantBinary: map[string]interface{}{"c": "Mg=="},
+		},
+		{
+			name:       "binary data",
+			data:       map[string]interface{}{"a": "1"},
+			binaryData: map[string]interface{}{"b": "Mg==", "c.key": "Mw=="},
+			filter:     api.KeyFilter{Exclude: []string{"*.key"}},
+			want:       map[string]interface{}{"a": "1"},
+			wantBinary: map[string]interface{}{"b": "Mg=="},
+		},
+		{
+			name:    "malformed pattern",
+			data:    map[string]interface{}{"a": "1"},
+			filter:  api.KeyFilter{Include: []string{"[a-"}},
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]interface{}{"data": c.data}}
+			if c.binaryData != nil {
+				obj.Object["binaryData"] = c.binaryData
+			}
+			err := strategy.MapKeys(obj, c.filter)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("MapKeys() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if c.wantErr {
+				return
+			}
+			if got := obj.Object["data"]; !reflect.DeepEqual(got, c.want) {
+				t.Errorf("data = %v, want %v", got, c.want)
+			}
+			if c.wantBinary != nil {
+				if got := obj.Object["binaryData"]; !reflect.DeepEqual(got, c.wantBinary) {
+					t.Errorf("binaryData = %v, want %v", got, c.wantBinary)
+				}
+			}
+		})
+	}
+}
+
+func TestMapKeysOfTypedSecrets(t *testing.T) {
+	cases := []struct {
+		name       string
+		secretType core.SecretType
+		data       map[string]interface{}
+		filter     api.KeyFilter
+		wantErr    string
+	}{
+		{
+			name:       "tls without certificate and key",
+			secretType: core.SecretTypeTLS,
+			data:       map[string]interface{}{"ca.crt": "Y2E=", "tls.crt": "Y3J0", "tls.key": "a2V5"},
+			filter:     api.KeyFilter{Include: []string{"ca.crt"}},
+			wantErr:    "require key tls.crt",
+		},
+		{
+			name:       "tls without key",
+			secretType: core.SecretTypeTLS,
+			data:       map[string]interface{}{"ca.crt": "Y2E=", "tls.crt": "Y3J0", "tls.key": "a2V5"},
+			filter:     api.KeyFilter{Exclude: []string{"*.key"}},
+			wantErr:    "require key tls.key",
+		},
+		{
+			name:       "tls without ca",
+			secretType: core.SecretTypeTLS,
+			data:       map[string]interface{}{"ca.crt": "Y2E=", "tls.crt": "Y3J0", "tls.key": "a2V5"},
+			filter:     api.KeyFilter{Exclude: []string{"ca.crt"}},
+		},
+		{
+			name:       "dockerconfigjson",
+			secretType: core.SecretTypeDockerConfigJson,
+			data:       map[string]interface{}{".dockerconfigjson": "e30="},
+			filter:     api.KeyFilter{Exclude: []string{".*"}},
+			wantErr:    "require key .dockerconfigjson",
+		},
+		{
+			name:       "basic-auth with password only",
+			secretType: core.SecretTypeBasicAuth,
+			data:       map[string]interface{}{"username": "YQ==", "password": "Yg=="},
+			filter:     api.KeyFilter{Include: []string{"password"}},
+		},
+		{
+			name:       "basic-auth without credentials",
+			secretType: core.SecretTypeBasicAuth,
+			data:       map[string]interface{}{"username": "YQ==", "password": "Yg==", "realm": "Yw=="},
+			filter:     api.KeyFilter{Include: []string{"realm"}},
+			wantErr:    "require key username or password",
+		},
+		{
+			name:       "tls with renamed key",
+			secretType: core.SecretTypeTLS,
+			data:       map[string]interface{}{"tls.crt": "Y3J0", "tls.key": "a2V5"},
+			filter:     api.KeyFilter{Rename: map[string]string{"tls.key": "server.key"}},
+			wantErr:    "require key tls.key",
+		},
+		{
+			name:       "opaque",
+			secretType: core.SecretTypeOpaque,
+			data:       map[string]interface{}{"ca.crt": "Y2E=", "tls.key": "a2V5"},
+			filter:     api.KeyFilter{Include: []string{"ca.crt"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"type":       string(c.secretType),
+				"data":       c.data,
+			}}
+			err := Secrets.Strategy.MapKeys(obj, c.filter)
+			if c.wantErr == "" {
+				if err != nil {
+					t.Errorf("MapKeys() = %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("MapKeys() = %v, want %q", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSourceRejectsTypedSecretFilters(t *testing.T) {
+	ts := newTestSyncer(t, Options{})
+	secret := &core.Secret{
+		Type: core.SecretTypeTLS,
+		Data: map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("crt"), "tls.key": []byte("key")},
+	}
+	secret.Name = "server-tls"
+	secret.Namespace = "demo"
+	secret.Annotations = map[string]string{ConfigSyncKey: "true", ConfigIncludeKeys: "ca.crt"}
+
+	err := ts.ValidateSource(Secrets.GroupVersionResource, nil, toUnstructured(t, secret))
+	if err == nil || !strings.Contains(err.Error(), "require key tls.crt") {
+		t.Errorf("ValidateSource() = %v, want the filter to be rejected", err)
+	}
+}
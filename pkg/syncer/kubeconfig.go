@@ -0,0 +1,345 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+	clientcmd_util "kmodules.xyz/client-go/tools/clientcmd"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// loadContexts parses the external kubeconfig file, assume that it doesn't include source cluster
+func loadContexts(kubeconfigFile string) (map[string]clusterContext, error) {
+	if kubeconfigFile == "" {
+		return map[string]clusterContext{}, nil
+	}
+
+	kConfig, err := clientcmd.LoadFromFile(kubeconfigFile)
+	if err != nil {
+		return nil, errors.Errorf("failed to parse context list. Reason: %v", err)
+	}
+	if err = clientcmd.ResolveLocalPaths(kConfig); err != nil {
+		return nil, err
+	}
+	return contextsFromConfig(kConfig), nil
+}
+
+// RemoteContext is a context of the kubeconfig file passed via --kubeconfig-file or of a cluster Secret.
+type RemoteContext struct {
+	Name      string
+	Namespace string
+	Address   string
+	Client    kubernetes.Interface
+	Dynamic   dynamic.Interface
+}
+
+// LoadRemoteContexts returns the valid contexts of a kubeconfig file and of the cluster Secrets in
+// clusterSecretNamespace, sorted by name. They are merged just like the operator merges them. If
+// clusterSecretNamespace is empty, cluster Secrets are ignored.
+func LoadRemoteContexts(kc kubernetes.Interface, kubeconfigFile, clusterSecretNamespace string) ([]RemoteContext, error) {
+	fileContexts, err := loadContexts(kubeconfigFile)
+	if err != nil {
+		return nil, err
+	}
+	secretContexts := map[string]map[string]clusterContext{}
+	if clusterSecretNamespace != "" {
+		secrets, err := kc.CoreV1().Secrets(clusterSecretNamespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{ClusterSecretLabelKey: ClusterSecretLabelValue}).String(),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list cluster secrets in namespace %s", clusterSecretNamespace)
+		}
+		for i := range secrets.Items {
+			secret := &secrets.Items[i]
+			contexts, err := contextsFromSecret(secret)
+			if err != nil {
+				klog.Warningf("skipping cluster secret %s/%s: %v", secret.Namespace, secret.Name, err)
+				continue
+			}
+			secretContexts[secret.Namespace+"/"+secret.Name] = contexts
+		}
+	}
+
+	contexts := mergeContexts(kubeconfigFile, fileContexts, secretContexts)
+	out := make([]RemoteContext, 0, len(contexts))
+	for name, ctx := range contexts {
+		out = append(out, RemoteContext{
+			Name:      name,
+			Namespace: ctx.Namespace,
+			Address:   ctx.Address,
+			Client:    ctx.Client,
+			Dynamic:   ctx.Dynamic,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// contextsFromConfig builds a clusterContext for every context of a kubeconfig. Invalid contexts are skipped.
+func contextsFromConfig(kConfig *clientcmdapi.Config) map[string]clusterContext {
+	contexts := map[string]clusterContext{}
+	for contextName, c := range kConfig.Contexts {
+		cfg, err := clientcmd.NewNonInteractiveClientConfig(*kConfig, contextName, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+		if err != nil {
+			continue
+		}
+		ctx, err := newClusterContext(clientcmd_util.Fix(cfg), c.Namespace, []interface{}{c, kConfig.Clusters[c.Cluster], kConfig.AuthInfos[c.AuthInfo]})
+		if err != nil {
+			continue
+		}
+		ctx.Cluster = c.Cluster
+		contexts[contextName] = ctx
+	}
+	return contexts
+}
+
+func newClusterContext(cfg *rest.Config, namespace string, config []interface{}) (clusterContext, error) {
+	ctx := clusterContext{
+		Namespace: namespace,
+		config:    config,
+	}
+
+	var err error
+	if ctx.Client, err = kubernetes.NewForConfig(cfg); err != nil {
+		return ctx, err
+	}
+	if ctx.Dynamic, err = dynamic.NewForConfig(cfg); err != nil {
+		return ctx, err
+	}
+
+	u, err := url.Parse(cfg.Host)
+	if err != nil {
+		return ctx, err
+	}
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		if u.Scheme == "https" {
+			port = "443"
+		} else if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	ctx.Address = host + ":" + port
+	return ctx, nil
+}
+
+// rebuildContexts merges the contexts of the kubeconfig file with those of the cluster Secrets and returns
+// the names of the contexts that were added, removed or modified. The caller must hold the write lock.
+func (s *ConfigSyncer) rebuildContexts() sets.String {
+	contexts := mergeContexts(s.kubeconfigFile, s.fileContexts, s.secretContexts)
+	changed := changedContexts(s.contexts, contexts)
+	removed := sets.NewString()
+	for _, name := range changed.List() {
+		if _, found := contexts[name]; !found {
+			forgetContext(name)
+			removed.Insert(name)
+		} else {
+			setContextCircuitOpen(name, false)
+		}
+	}
+	s.resetHealth(changed)
+	s.warnOrphanedCopies(removed)
+	s.contexts = contexts
+	return changed
+}
+
+// mergeContexts merges the contexts of the kubeconfig file with those of the cluster Secrets, which are keyed
+// by namespace/name of the Secret. A context defined by several Secrets is taken from the first one by key,
+// and the contexts of the kubeconfig file override those of the Secrets.
+func mergeContexts(kubeconfigFile string, fileContexts map[string]clusterContext, secretContexts map[string]map[string]clusterContext) map[string]clusterContext {
+	contexts := map[string]clusterContext{}
+	keys := make([]string, 0, len(secretContexts))
+	for key := range secretContexts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for name, ctx := range secretContexts[key] {
+			if _, found := contexts[name]; found {
+				klog.Warningf("context %s defined in cluster secret %s is already defined in another cluster secret", name, key)
+				continue
+			}
+			contexts[name] = ctx
+		}
+	}
+	for name, ctx := range fileContexts {
+		if _, found := contexts[name]; found {
+			klog.Warningf("context %s in kubeconfig file %s overrides a cluster secret", name, kubeconfigFile)
+		}
+		contexts[name] = ctx
+	}
+	return contexts
+}
+
+// warnOrphanedCopies logs the sources that were synced into contexts that were removed.
+// Their copies in those clusters can no longer be reached and have to be deleted manually.
+func (s *ConfigSyncer) warnOrphanedCopies(removed sets.String) {
+	if removed.Len() == 0 {
+		return
+	}
+	s.forEachSourceInContexts(removed, func(r *resourceSyncer, src *unstructured.Unstructured) {
+		contexts := s.syncOptionsFor(r.SourceKind(), src).Contexts.Intersection(removed)
+		klog.Warningf("contexts %v were removed, copies of %s %s/%s in these clusters are no longer managed and must be deleted manually",
+			contexts.List(), r.Kind, src.GetNamespace(), src.GetName())
+	})
+}
+
+// changedContexts returns the names of the contexts that were added, removed or modified.
+func changedContexts(old, nu map[string]clusterContext) sets.String {
+	changed := sets.NewString()
+	for name, ctx := range nu {
+		if o, found := old[name]; !found ||
+			o.Address != ctx.Address ||
+			o.Namespace != ctx.Namespace ||
+			!reflect.DeepEqual(o.config, ctx.config) {
+			changed.Insert(name)
+		}
+	}
+	for name := range old {
+		if _, found := nu[name]; !found {
+			changed.Insert(name)
+		}
+	}
+	return changed
+}
+
+// ReloadKubeConfig rebuilds the contexts from the kubeconfig file and re-syncs
+// the sources that are synced into a context that was added, removed or modified.
+func (s *ConfigSyncer) ReloadKubeConfig() error {
+	s.lock.Lock()
+	contexts, err := loadContexts(s.kubeconfigFile)
+	if err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	s.fileContexts = contexts
+	changed := s.rebuildContexts()
+	s.lock.Unlock()
+
+	if changed.Len() > 0 {
+		klog.Infof("contexts %v changed in kubeconfig file %s", changed.List(), s.kubeconfigFile)
+		s.enqueueSourcesForContexts(changed)
+	}
+	return nil
+}
+
+// forEachSourceInContexts calls fn for every source that is synced into any of the contexts.
+func (s *ConfigSyncer) forEachSourceInContexts(contexts sets.String, fn func(r *resourceSyncer, src *unstructured.Unstructured)) {
+	for _, r := range s.resources {
+		for _, obj := range r.indexer.List() {
+			src := obj.(*unstructured.Unstructured)
+			if isSyncStatus(src) {
+				continue
+			}
+			if s.syncOptionsFor(r.SourceKind(), src).Contexts.HasAny(contexts.List()...) {
+				fn(r, src)
+			}
+		}
+	}
+}
+
+// enqueueSourcesForContexts enqueues the sources and policies that sync into any of the contexts.
+// Standby replicas skip this, since every source is synced once they start leading.
+func (s *ConfigSyncer) enqueueSourcesForContexts(contexts sets.String) {
+	s.lock.RLock()
+	leading := s.leading
+	s.lock.RUnlock()
+	if !leading {
+		return
+	}
+
+	s.forEachSourceInContexts(contexts, func(r *resourceSyncer, src *unstructured.Unstructured) {
+		queue.Enqueue(r.queue.GetQueue(), src)
+	})
+	for _, obj := range s.policyIndexer.List() {
+		policy, err := toSyncPolicy(obj)
+		if err != nil {
+			klog.Errorln(err)
+			continue
+		}
+		if contexts.HasAny(policy.Spec.Target.Contexts...) {
+			queue.Enqueue(s.policyQueue.GetQueue(), policy)
+		}
+	}
+}
+
+// WatchKubeConfig reloads the kubeconfig file whenever it changes. Both in place updates of the file
+// and updates of a mounted Secret or ConfigMap holding the file are detected.
+func (s *ConfigSyncer) WatchKubeConfig(stopCh <-chan struct{}) error {
+	s.lock.RLock()
+	kubeconfigFile := filepath.Clean(s.kubeconfigFile)
+	s.lock.RUnlock()
+	if kubeconfigFile == "." {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(kubeconfigFile)
+	if err = watcher.Add(dir); err != nil {
+		_ = watcher.Close()
+		return errors.Errorf("error watching dir %s. Reason: %s", dir, err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				filename := filepath.Clean(event.Name)
+				// mounted volumes are updated by atomically swapping the ..data symlink
+				if (filename == kubeconfigFile && event.Op&(fsnotify.Write|fsnotify.Create) != 0) ||
+					(filename == filepath.Join(dir, "..data") && event.Op&fsnotify.Create != 0) {
+					if err := s.ReloadKubeConfig(); err != nil {
+						klog.Errorf("failed to reload kubeconfig file %s: %v", kubeconfigFile, err)
+					}
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				klog.Errorln("error:", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestChangedContexts(t *testing.T) {
+	old := map[string]clusterContext{
+		"same":      {Address: "a:443", Namespace: "demo", config: []interface{}{"token-a"}},
+		"moved":     {Address: "b:443"},
+		"namespace": {Address: "c:443", Namespace: "demo"},
+		"rotated":   {Address: "d:443", config: []interface{}{"token-d"}},
+		"removed":   {Address: "e:443"},
+	}
+	nu := map[string]clusterContext{
+		"same":      {Address: "a:443", Namespace: "demo", config: []interface{}{"token-a"}},
+		"moved":     {Address: "b2:443"},
+		"namespace": {Address: "c:443", Namespace: "team"},
+		"rotated":   {Address: "d:443", config: []interface{}{"token-d2"}},
+		"added":     {Address: "f:443"},
+	}
+	want := sets.NewString("moved", "namespace", "rotated", "removed", "added")
+	if got := changedContexts(old, nu); !got.Equal(want) {
+		t.Errorf("changedContexts() = %v, want %v", got.List(), want.List())
+	}
+	if got := changedContexts(nu, nu); got.Len() > 0 {
+		t.Errorf("changedContexts() = %v for unchanged contexts", got.List())
+	}
+}
+
+func TestRebuildContexts(t *testing.T) {
+	ts := newTestSyncer(t, Options{})
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	ts.secretContexts = map[string]map[string]clusterContext{
+		"kube-system/a": {"remote": {Address: "a:443"}, "shared": {Address: "a:443"}},
+		"kube-system/b": {"shared": {Address: "b:443"}, "other": {Address: "b:443"}},
+	}
+	ts.fileContexts = map[string]clusterContext{"other": {Address: "file:443"}}
+	changed := ts.rebuildContexts()
+	if want := sets.NewString("remote", "shared", "other"); !changed.Equal(want) {
+		t.Errorf("rebuildContexts() = %v, want %v", changed.List(), want.List())
+	}
+	// the first cluster secret wins over later ones, the kubeconfig file over both
+	if got := ts.contexts["shared"].Address; got != "a:443" {
+		t.Errorf("shared context address = %s, want a:443", got)
+	}
+	if got := ts.contexts["other"].Address; got != "file:443" {
+		t.Errorf("other context address = %s, want file:443", got)
+	}
+
+	delete(ts.secretContexts, "kube-system/a")
+	changed = ts.rebuildContexts()
+	if want := sets.NewString("remote", "shared"); !changed.Equal(want) {
+		t.Errorf("rebuildContexts() = %v, want %v", changed.List(), want.List())
+	}
+	if _, found := ts.contexts["remote"]; found {
+		t.Errorf("removed context remote is still registered")
+	}
+	if got := ts.contexts["shared"].Address; got != "b:443" {
+		t.Errorf("shared context address = %s, want b:443", got)
+	}
+
+	if changed = ts.rebuildContexts(); changed.Len() > 0 {
+		t.Errorf("rebuildContexts() = %v without changes", changed.List())
+	}
+}
+
+func TestLoadRemoteContexts(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: remote
+  cluster:
+    server: https://file.example.com
+users:
+- name: remote
+  user:
+    token: token
+contexts:
+- name: remote
+  context:
+    cluster: remote
+    user: remote
+    namespace: demo
+`
+	kubeconfigFile := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(kubeconfigFile, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clusterSecret := func(namespace, name string, labelled bool, data map[string]string) *core.Secret {
+		secret := &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       map[string][]byte{},
+		}
+		if labelled {
+			secret.Labels = map[string]string{ClusterSecretLabelKey: ClusterSecretLabelValue}
+		}
+		for k, v := range data {
+			secret.Data[k] = []byte(v)
+		}
+		return secret
+	}
+	kc := fake.NewSimpleClientset(
+		clusterSecret("kube-system", "prod", true, map[string]string{ClusterSecretServerKey: "https://prod.example.com", ClusterSecretTokenKey: "token"}),
+		clusterSecret("kube-system", "shadowed", true, map[string]string{ClusterSecretNameKey: "remote", ClusterSecretServerKey: "https://secret.example.com"}),
+		clusterSecret("kube-system", "invalid", true, map[string]string{ClusterSecretTokenKey: "token"}),
+		clusterSecret("kube-system", "unlabelled", false, map[string]string{ClusterSecretServerKey: "https://unlabelled.example.com"}),
+		clusterSecret("other", "elsewhere", true, map[string]string{ClusterSecretServerKey: "https://elsewhere.example.com"}),
+	)
+
+	cases := []struct {
+		name                   string
+		kubeconfigFile         string
+		clusterSecretNamespace string
+		want                   map[string]string
+	}{
+		{
+			name:           "kubeconfig file",
+			kubeconfigFile: kubeconfigFile,
+			want:           map[string]string{"remote": "file.example.com:443"},
+		},
+		{
+			name:                   "cluster secrets",
+			clusterSecretNamespace: "kube-system",
+			want:                   map[string]string{"prod": "prod.example.com:443", "remote": "secret.example.com:443"},
+		},
+		{
+			name:                   "both",
+			kubeconfigFile:         kubeconfigFile,
+			clusterSecretNamespace: "kube-system",
+			want:                   map[string]string{"prod": "prod.example.com:443", "remote": "file.example.com:443"},
+		},
+		{
+			name: "none",
+			want: map[string]string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			contexts, err := LoadRemoteContexts(kc, c.kubeconfigFile, c.clusterSecretNamespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, rc := range contexts {
+				got[rc.Name] = rc.Address
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("LoadRemoteContexts() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"sync"
+	"time"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const metricsNamespace = "config_syncer"
+
+var (
+	syncAttempts = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "sync_attempts_total",
+			Help:           "Number of attempts to create, update or delete a copy of a source.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind", "source_namespace", "context"},
+	)
+	syncFailures = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "sync_failures_total",
+			Help:           "Number of failed attempts to create, update or delete a copy of a source.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind", "source_namespace", "context"},
+	)
+	syncUpserts = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "sync_upserts_total",
+			Help:           "Number of copies created or updated.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind", "source_namespace", "context"},
+	)
+	syncDeletes = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "sync_deletes_total",
+			Help:           "Number of copies deleted.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind", "source_namespace", "context"},
+	)
+	syncSkips = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "sync_skips_total",
+			Help:           "Number of targets skipped because an object that is not a copy exists.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind", "source_namespace", "context"},
+	)
+	driftCorrections = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "drift_corrections_total",
+			Help:           "Number of modified or deleted copies restored from their source.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind", "source_namespace"},
+	)
+	orphanedCopies = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "orphaned_copies",
+			Help:           "Number of copies found by the last garbage collection whose source no longer exists or no longer selects them.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind", "context"},
+	)
+	gcDeletes = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Name:           "gc_deletes_total",
+			Help:           "Number of orphaned copies deleted by garbage collection.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind", "context"},
+	)
+	syncDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      metricsNamespace,
+			Name:           "sync_duration_seconds",
+			Help:           "Time taken to create or update a copy of a source.",
+			Buckets:        metrics.DefBuckets,
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind", "source_namespace", "context"},
+	)
+	managedCopies = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "managed_copies",
+			Help:           "Number of copies of a source that are in sync.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind", "source_namespace", "source_name"},
+	)
+	contextReachable = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "context_reachable",
+			Help:           "Whether the last health probe of the cluster of a remote context succeeded (1) or not (0).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"context"},
+	)
+	contextCircuitOpen = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Name:           "context_circuit_open",
+			Help:           "Whether a remote context is skipped because it failed too many health probes in a row (1) or not (0).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"context"},
+	)
+)
+
+var registerMetrics sync.Once
+
+// RegisterMetrics registers the syncer metrics with the legacy registry served at /metrics.
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(
+			syncAttempts,
+			syncFailures,
+			syncUpserts,
+			syncDeletes,
+			syncSkips,
+			driftCorrections,
+			orphanedCopies,
+			gcDeletes,
+			syncDuration,
+			managedCopies,
+			contextReachable,
+			contextCircuitOpen,
+		)
+	})
+}
+
+func sourceLabels(src runtime.Object) (string, string) {
+	kind := src.GetObjectKind().GroupVersionKind().Kind
+	if obj, ok := src.(metav1.Object); ok {
+		return kind, obj.GetNamespace()
+	}
+	return kind, ""
+}
+
+func observeSyncDuration(kind string, namespace, ctx string, start time.Time) {
+	syncDuration.WithLabelValues(kind, namespace, ctx).Observe(time.Since(start).Seconds())
+}
+
+func setManagedCopies(kind string, namespace, name string, status *api.SyncStatus) {
+	n := 0
+	for _, t := range status.Targets {
+		if t.Phase == api.TargetPhaseSynced {
+			n++
+		}
+	}
+	managedCopies.WithLabelValues(kind, namespace, name).Set(float64(n))
+}
+
+func forgetManagedCopies(kind string, namespace, name string) {
+	managedCopies.Delete(map[string]string{
+		"kind":             kind,
+		"source_namespace": namespace,
+		"source_name":      name,
+	})
+}
+
+// setContextReachable records whether the last health probe of a context succeeded.
+func setContextReachable(ctx string, err error) {
+	if err != nil {
+		contextReachable.WithLabelValues(ctx).Set(0)
+	} else {
+		contextReachable.WithLabelValues(ctx).Set(1)
+	}
+}
+
+func setContextCircuitOpen(ctx string, open bool) {
+	if open {
+		contextCircuitOpen.WithLabelValues(ctx).Set(1)
+	} else {
+		contextCircuitOpen.WithLabelValues(ctx).Set(0)
+	}
+}
+
+func forgetContext(ctx string) {
+	contextReachable.Delete(map[string]string{"context": ctx})
+	contextCircuitOpen.Delete(map[string]string{"context": ctx})
+}
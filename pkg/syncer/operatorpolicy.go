@@ -0,0 +1,93 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// OperatorPolicy restricts which namespaces take part in syncs. Unlike a SyncPolicy, it is set by the
+// administrator of Config Syncer and applies to every source.
+type OperatorPolicy struct {
+	// Namespaces whose objects may be synced. Entries may be shell patterns, eg, team-*. If empty, every namespace may be a source.
+	SourceNamespaces []string `json:"sourceNamespaces,omitempty"`
+	// Namespaces that never receive copies, in the source cluster or in any remote context. Entries may be shell patterns.
+	DeniedTargetNamespaces []string `json:"deniedTargetNamespaces,omitempty"`
+	// Maximum number of namespaces and contexts a source may be synced into. Zero means no limit.
+	MaxFanOut int `json:"maxFanOut,omitempty"`
+}
+
+// LoadOperatorPolicy reads an OperatorPolicy from a YAML or JSON file.
+func LoadOperatorPolicy(filename string) (*OperatorPolicy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var p OperatorPolicy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse operator policy %s", filename)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid operator policy %s", filename)
+	}
+	return &p, nil
+}
+
+func (p *OperatorPolicy) Validate() error {
+	for _, patterns := range [][]string{p.SourceNamespaces, p.DeniedTargetNamespaces} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return errors.Wrapf(err, "invalid namespace pattern %q", pattern)
+			}
+		}
+	}
+	if p.MaxFanOut < 0 {
+		return errors.Errorf("maxFanOut must not be negative")
+	}
+	return nil
+}
+
+// AllowsSource returns true if objects in namespace may be synced. A nil policy allows everything.
+func (p *OperatorPolicy) AllowsSource(namespace string) bool {
+	if p == nil || len(p.SourceNamespaces) == 0 {
+		return true
+	}
+	return namespaceMatches(p.SourceNamespaces, namespace)
+}
+
+// DeniesTarget returns true if namespace must not receive copies.
+func (p *OperatorPolicy) DeniesTarget(namespace string) bool {
+	return p != nil && namespaceMatches(p.DeniedTargetNamespaces, namespace)
+}
+
+// ExceedsFanOut returns true if a source may not be synced into n targets.
+func (p *OperatorPolicy) ExceedsFanOut(n int) bool {
+	return p != nil && p.MaxFanOut > 0 && n > p.MaxFanOut
+}
+
+func namespaceMatches(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestOperatorPolicyAllowsSource(t *testing.T) {
+	cases := []struct {
+		name      string
+		policy    *OperatorPolicy
+		namespace string
+		want      bool
+	}{
+		{name: "nil policy", policy: nil, namespace: "a", want: true},
+		{name: "no sources", policy: &OperatorPolicy{}, namespace: "a", want: true},
+		{name: "exact", policy: &OperatorPolicy{SourceNamespaces: []string{"a"}}, namespace: "a", want: true},
+		{name: "pattern", policy: &OperatorPolicy{SourceNamespaces: []string{"team-*"}}, namespace: "team-a", want: true},
+		{name: "not listed", policy: &OperatorPolicy{SourceNamespaces: []string{"team-*"}}, namespace: "kube-system", want: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.policy.AllowsSource(c.namespace); got != c.want {
+				t.Errorf("AllowsSource(%q) = %v, want %v", c.namespace, got, c.want)
+			}
+		})
+	}
+}
+
+func TestOperatorPolicyDeniesTarget(t *testing.T) {
+	cases := []struct {
+		name      string
+		policy    *OperatorPolicy
+		namespace string
+		want      bool
+	}{
+		{name: "nil policy", policy: nil, namespace: "kube-system", want: false},
+		{name: "no denied", policy: &OperatorPolicy{}, namespace: "kube-system", want: false},
+		{name: "exact", policy: &OperatorPolicy{DeniedTargetNamespaces: []string{"kube-system"}}, namespace: "kube-system", want: true},
+		{name: "pattern", policy: &OperatorPolicy{DeniedTargetNamespaces: []string{"kube-*"}}, namespace: "kube-public", want: true},
+		{name: "not denied", policy: &OperatorPolicy{DeniedTargetNamespaces: []string{"kube-*"}}, namespace: "default", want: false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.policy.DeniesTarget(c.namespace); got != c.want {
+				t.Errorf("DeniesTarget(%q) = %v, want %v", c.namespace, got, c.want)
+			}
+		})
+	}
+}
+
+func TestOperatorPolicyExceedsFanOut(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy *OperatorPolicy
+		n      int
+		want   bool
+	}{
+		{name: "nil policy", policy: nil, n: 1000, want: false},
+		{name: "no limit", policy: &OperatorPolicy{}, n: 1000, want: false},
+		{name: "below", policy: &OperatorPolicy{MaxFanOut: 3}, n: 2, want: false},
+		{name: "at limit", policy: &OperatorPolicy{MaxFanOut: 3}, n: 3, want: false},
+		{name: "above", policy: &OperatorPolicy{MaxFanOut: 3}, n: 4, want: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.policy.ExceedsFanOut(c.n); got != c.want {
+				t.Errorf("ExceedsFanOut(%d) = %v, want %v", c.n, got, c.want)
+			}
+		})
+	}
+}
+
+func TestOperatorPolicyValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  OperatorPolicy
+		wantErr bool
+	}{
+		{name: "empty", policy: OperatorPolicy{}},
+		{name: "valid", policy: OperatorPolicy{SourceNamespaces: []string{"team-*"}, DeniedTargetNamespaces: []string{"kube-?"}, MaxFanOut: 10}},
+		{name: "malformed source", policy: OperatorPolicy{SourceNamespaces: []string{"[a-"}}, wantErr: true},
+		{name: "malformed denied", policy: OperatorPolicy{DeniedTargetNamespaces: []string{"[a-"}}, wantErr: true},
+		{name: "negative fan-out", policy: OperatorPolicy{MaxFanOut: -1}, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.policy.Validate(); (err != nil) != c.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadOperatorPolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "valid", data: "sourceNamespaces: [team-*]\ndeniedTargetNamespaces: [kube-system]\nmaxFanOut: 10\n"},
+		{name: "unknown field", data: "sourceNamespace: [team-*]\n", wantErr: true},
+		{name: "invalid pattern", data: "deniedTargetNamespaces: [\"[\"]\n", wantErr: true},
+		{name: "negative fan-out", data: "maxFanOut: -1\n", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(filename, []byte(c.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			p, err := LoadOperatorPolicy(filename)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("LoadOperatorPolicy() error = %v, wantErr %v", err, c.wantErr)
+			}
+			if err == nil && (p.MaxFanOut != 10 || !p.AllowsSource("team-a") || !p.DeniesTarget("kube-system")) {
+				t.Errorf("LoadOperatorPolicy() = %+v", p)
+			}
+		})
+	}
+}
+
+func TestSyncEnforcesOperatorPolicy(t *testing.T) {
+	cases := []struct {
+		name       string
+		policy     *OperatorPolicy
+		wantCopies []string
+		wantEvent  string
+	}{
+		{
+			name:       "allowed",
+			policy:     &OperatorPolicy{SourceNamespaces: []string{"demo"}},
+			wantCopies: []string{"kube-system", "old", "team"},
+		},
+		{
+			name:      "source not allowed",
+			policy:    &OperatorPolicy{SourceNamespaces: []string{"team-*"}},
+			wantEvent: "Namespace demo may not be a sync source",
+		},
+		{
+			name:       "denied target",
+			policy:     &OperatorPolicy{DeniedTargetNamespaces: []string{"kube-*"}},
+			wantCopies: []string{"old", "team"},
+		},
+		{
+			name:   "fan-out exceeded",
+			policy: &OperatorPolicy{MaxFanOut: 2},
+			// the existing copy is left alone until the source is fixed
+			wantCopies: []string{"old"},
+			wantEvent:  "Refused to sync into 3 targets, at most 2 are allowed",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			old := newCopy("old", "omni", "demo", "omni")
+			old.ResourceVersion = "1"
+			objs := []runtime.Object{
+				newNamespace("demo", nil, nil),
+				newNamespace("team", nil, nil),
+				newNamespace("old", nil, nil),
+				newNamespace("kube-system", nil, nil),
+				newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"}),
+				old,
+			}
+			ts := newTestSyncer(t, Options{Policy: c.policy}, objs...)
+			if err := ts.sync(ts.resourceFor(ConfigMaps.GroupVersionResource), toUnstructured(t, objs[4])); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]bool{}
+			for _, ns := range c.wantCopies {
+				want[ns] = true
+			}
+			for _, ns := range []string{"team", "old", "kube-system"} {
+				_, err := ts.dc.Resource(ConfigMaps.GroupVersionResource).Namespace(ns).Get(context.TODO(), "omni", metav1.GetOptions{})
+				if err != nil && !kerr.IsNotFound(err) {
+					t.Fatal(err)
+				}
+				if exists := err == nil; exists != want[ns] {
+					t.Errorf("copy in namespace %s exists = %v, want %v", ns, exists, want[ns])
+				}
+			}
+
+			events := strings.Join(ts.events(), "\n")
+			if c.wantEvent != "" && !strings.Contains(events, c.wantEvent) {
+				t.Errorf("events = %q, want %q", events, c.wantEvent)
+			}
+			if c.wantEvent == "" && strings.Contains(events, core.EventTypeWarning) {
+				t.Errorf("events = %q, want no warnings", events)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// NamespaceExcludeKey is a namespace annotation that excludes the namespace from syncs.
+	// Its value is either "true" for all sources, or a comma separated list of sources as <namespace>/<name>,
+	// which matches sources of any kind, or as <kind>/<namespace>/<name>.
+	NamespaceExcludeKey = "kubed.appscode.com/sync-exclude"
+	// UnmanagedKey is a copy annotation that stops Config Syncer from updating or deleting the copy.
+	UnmanagedKey = "kubed.appscode.com/unmanaged"
+)
+
+// Excludes returns true if the namespace opted out of syncs of src, a source of the given kind.
+func Excludes(ns *core.Namespace, kind string, src metav1.Object) bool {
+	v, ok := ns.Annotations[NamespaceExcludeKey]
+	if !ok {
+		return false
+	}
+	if v == "true" {
+		return true
+	}
+	key := src.GetNamespace() + "/" + src.GetName()
+	for _, ref := range strings.Split(v, ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == key {
+			return true
+		}
+		if k, rest, ok := strings.Cut(ref, "/"); ok && strings.Count(rest, "/") == 1 && strings.EqualFold(k, kind) && rest == key {
+			return true
+		}
+	}
+	return false
+}
+
+// contextExcludes returns true if the namespace of a remote context opted out of syncs of src.
+func contextExcludes(client kubernetes.Interface, namespace, kind string, src metav1.Object) (bool, error) {
+	ns, err := client.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return Excludes(ns, kind, src), nil
+}
+
+// isUnmanaged returns true if the copy must not be updated or deleted.
+func isUnmanaged(obj metav1.Object) bool {
+	return obj.GetAnnotations()[UnmanagedKey] == "true"
+}
+
+var errUnmanaged = errors.Errorf("copy is annotated %s=true", UnmanagedKey)
+
+// enqueueSourcesWithCopiesIn enqueues the sources that have copies in a namespace of the source cluster,
+// so that copies are removed from the namespace when it is no longer selected.
+func (s *ConfigSyncer) enqueueSourcesWithCopiesIn(namespace string) {
+	for _, r := range s.resources {
+		if r.copyIndexer == nil {
+			continue
+		}
+		objs, err := r.copyIndexer.ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			klog.Errorln(err)
+			continue
+		}
+		for _, obj := range objs {
+			lbls := obj.(*unstructured.Unstructured).GetLabels()
+			if lbls[OriginClusterLabelKey] != s.clusterName {
+				continue
+			}
+			r.queue.GetQueue().Add(lbls[OriginNamespaceLabelKey] + "/" + lbls[OriginNameLabelKey])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExcludes(t *testing.T) {
+	src := newConfigMap("demo", "omni", nil)
+	cases := []struct {
+		name       string
+		annotation *string
+		kind       string
+		want       bool
+	}{
+		{name: "no annotation", kind: "ConfigMap"},
+		{name: "all sources", annotation: strPtr("true"), kind: "ConfigMap", want: true},
+		{name: "false", annotation: strPtr("false"), kind: "ConfigMap"},
+		{name: "source of any kind", annotation: strPtr("demo/omni"), kind: "Secret", want: true},
+		{name: "source in list", annotation: strPtr("demo/other, demo/omni"), kind: "ConfigMap", want: true},
+		{name: "other source", annotation: strPtr("demo/other"), kind: "ConfigMap"},
+		{name: "other namespace", annotation: strPtr("team/omni"), kind: "ConfigMap"},
+		{name: "kind", annotation: strPtr("configmap/demo/omni"), kind: "ConfigMap", want: true},
+		{name: "kind is case insensitive", annotation: strPtr("ConfigMap/demo/omni"), kind: "ConfigMap", want: true},
+		{name: "other kind", annotation: strPtr("secret/demo/omni"), kind: "ConfigMap"},
+		{name: "too many segments", annotation: strPtr("configmap/demo/omni/extra"), kind: "ConfigMap"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var annotations map[string]string
+			if c.annotation != nil {
+				annotations = map[string]string{NamespaceExcludeKey: *c.annotation}
+			}
+			ns := newNamespace("team", nil, annotations)
+			if got := Excludes(ns, c.kind, src); got != c.want {
+				t.Errorf("Excludes() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestOptedOutNamespaceLosesCopy(t *testing.T) {
+	src := newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"})
+	ts := newTestSyncer(t, Options{},
+		newNamespace("demo", nil, nil),
+		newNamespace("team", nil, map[string]string{NamespaceExcludeKey: "configmap/demo/omni"}),
+		src,
+		newCopy("team", "omni", "demo", "omni"),
+	)
+	if err := ts.sync(ts.resourceFor(ConfigMaps.GroupVersionResource), toUnstructured(t, src)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.dc.Resource(ConfigMaps.GroupVersionResource).Namespace("team").Get(context.TODO(), "omni", metav1.GetOptions{}); err == nil {
+		t.Errorf("copy in a namespace that opted out was not deleted")
+	}
+}
+
+func TestUnmanagedCopyIsKept(t *testing.T) {
+	src := newConfigMap("demo", "omni", nil)
+	unmanaged := newCopy("team", "omni", "demo", "omni")
+	unmanaged.Annotations = map[string]string{UnmanagedKey: "true"}
+	unmanaged.Data = map[string]string{"local": "edit"}
+	ts := newTestSyncer(t, Options{},
+		newNamespace("demo", nil, nil),
+		newNamespace("team", nil, nil),
+		src,
+		unmanaged,
+	)
+	// the source lost its sync annotations, so its copies are deleted
+	if err := ts.sync(ts.resourceFor(ConfigMaps.GroupVersionResource), toUnstructured(t, src)); err != nil {
+		t.Fatal(err)
+	}
+	u, err := ts.dc.Resource(ConfigMaps.GroupVersionResource).Namespace("team").Get(context.TODO(), "omni", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unmanaged copy was deleted: %v", err)
+	}
+	if got := u.Object["data"].(map[string]interface{})["local"]; got != "edit" {
+		t.Errorf("unmanaged copy was modified: %v", u.Object["data"])
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
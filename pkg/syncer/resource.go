@@ -0,0 +1,157 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+	"strings"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// FieldStrategy lists the top level fields of a resource that are copied from a source into its copies.
+type FieldStrategy struct {
+	// Fields copied from the source. If empty, every top level field
+	// except apiVersion, kind, metadata and status is copied.
+	Fields []string
+	// KeyFields are the fields holding a map of data keys that can be filtered.
+	KeyFields []string
+}
+
+var fieldStrategies = map[schema.GroupKind]FieldStrategy{
+	{Group: core.GroupName, Kind: "ConfigMap"}:           {Fields: []string{"data", "binaryData"}, KeyFields: []string{"data", "binaryData"}},
+	{Group: core.GroupName, Kind: "Secret"}:              {Fields: []string{"type", "data"}, KeyFields: []string{"data"}},
+	{Group: core.GroupName, Kind: "ServiceAccount"}:      {Fields: []string{"automountServiceAccountToken", "imagePullSecrets"}},
+	{Group: core.GroupName, Kind: "LimitRange"}:          {Fields: []string{"spec"}},
+	{Group: core.GroupName, Kind: "ResourceQuota"}:       {Fields: []string{"spec"}},
+	{Group: rbac.GroupName, Kind: "Role"}:                {Fields: []string{"rules"}},
+	{Group: rbac.GroupName, Kind: "RoleBinding"}:         {Fields: []string{"roleRef", "subjects"}},
+	{Group: networking.GroupName, Kind: "NetworkPolicy"}: {Fields: []string{"spec"}},
+}
+
+// FieldStrategyFor returns the field strategy used for a kind.
+func FieldStrategyFor(gk schema.GroupKind) FieldStrategy {
+	return fieldStrategies[gk]
+}
+
+func (f FieldStrategy) fieldsOf(obj *unstructured.Unstructured) []string {
+	if len(f.Fields) > 0 {
+		return f.Fields
+	}
+	fields := make([]string, 0, len(obj.Object))
+	for k := range obj.Object {
+		switch k {
+		case "apiVersion", "kind", "metadata", "status":
+		default:
+			fields = append(fields, k)
+		}
+	}
+	return fields
+}
+
+// Copy sets the synced fields of dst to those of src. Fields missing in src are removed from dst.
+func (f FieldStrategy) Copy(dst, src *unstructured.Unstructured) {
+	if len(f.Fields) == 0 {
+		// remove fields that were dropped from the source
+		for _, k := range f.fieldsOf(dst) {
+			delete(dst.Object, k)
+		}
+	}
+	for _, k := range f.fieldsOf(src) {
+		if v, ok := src.Object[k]; ok {
+			dst.Object[k] = runtime.DeepCopyJSONValue(v)
+		} else {
+			delete(dst.Object, k)
+		}
+	}
+}
+
+// Changed returns true if the labels, annotations or synced fields differ between old and nu.
+func (f FieldStrategy) Changed(old, nu *unstructured.Unstructured) bool {
+	if !reflect.DeepEqual(old.GetLabels(), nu.GetLabels()) ||
+		!reflect.DeepEqual(old.GetAnnotations(), nu.GetAnnotations()) {
+		return true
+	}
+	for _, k := range append(f.fieldsOf(old), f.fieldsOf(nu)...) {
+		if !reflect.DeepEqual(old.Object[k], nu.Object[k]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resource is a namespaced resource whose objects are synced.
+type Resource struct {
+	schema.GroupVersionResource
+	Kind     string
+	Strategy FieldStrategy
+}
+
+func NewResource(gvr schema.GroupVersionResource, kind string) Resource {
+	return Resource{
+		GroupVersionResource: gvr,
+		Kind:                 kind,
+		Strategy:             FieldStrategyFor(schema.GroupKind{Group: gvr.Group, Kind: kind}),
+	}
+}
+
+func (r Resource) GroupVersionKind() schema.GroupVersionKind {
+	return r.GroupVersion().WithKind(r.Kind)
+}
+
+// SourceKind returns the kind a SyncPolicy uses to select sources of this resource.
+func (r Resource) SourceKind() api.SourceKind {
+	if r.Group != core.GroupName {
+		return ""
+	}
+	return api.SourceKind(r.Kind)
+}
+
+var (
+	ConfigMaps = NewResource(core.SchemeGroupVersion.WithResource("configmaps"), "ConfigMap")
+	Secrets    = NewResource(core.SchemeGroupVersion.WithResource("secrets"), "Secret")
+)
+
+// DefaultResources are always synced.
+func DefaultResources() []Resource {
+	return []Resource{ConfigMaps, Secrets}
+}
+
+// ParseGroupVersionResource parses a resource in the form <group>/<version>/<resource>,
+// or <version>/<resource> for the core group, eg, rbac.authorization.k8s.io/v1/roles.
+func ParseGroupVersionResource(s string) (schema.GroupVersionResource, error) {
+	parts := strings.Split(s, "/")
+	switch len(parts) {
+	case 2:
+		if parts[0] != "" && parts[1] != "" {
+			return schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}, nil
+		}
+	case 3:
+		if parts[0] != "" && parts[1] != "" && parts[2] != "" {
+			return schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}, nil
+		}
+	}
+	return schema.GroupVersionResource{}, errors.Errorf("invalid resource %q, expected <group>/<version>/<resource> or <version>/<resource>", s)
+}
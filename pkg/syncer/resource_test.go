@@ -0,0 +1,153 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestFieldStrategyCopy(t *testing.T) {
+	generic := FieldStrategyFor(schema.GroupKind{Group: "example.com", Kind: "Widget"})
+	cases := []struct {
+		name     string
+		strategy FieldStrategy
+		dst      map[string]interface{}
+		src      map[string]interface{}
+		want     map[string]interface{}
+	}{
+		{
+			name:     "configmap copies data and removes binaryData",
+			strategy: ConfigMaps.Strategy,
+			dst: map[string]interface{}{
+				"metadata":   map[string]interface{}{"name": "copy"},
+				"data":       map[string]interface{}{"old": "value"},
+				"binaryData": map[string]interface{}{"bin": "AA=="},
+			},
+			src: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "source"},
+				"data":     map[string]interface{}{"you": "only"},
+			},
+			want: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "copy"},
+				"data":     map[string]interface{}{"you": "only"},
+			},
+		},
+		{
+			name:     "secret copies type",
+			strategy: Secrets.Strategy,
+			dst:      map[string]interface{}{},
+			src: map[string]interface{}{
+				"type":       "kubernetes.io/tls",
+				"data":       map[string]interface{}{"tls.crt": "Y3J0", "tls.key": "a2V5"},
+				"immutable":  true,
+				"stringData": map[string]interface{}{"ignored": "value"},
+			},
+			want: map[string]interface{}{
+				"type": "kubernetes.io/tls",
+				"data": map[string]interface{}{"tls.crt": "Y3J0", "tls.key": "a2V5"},
+			},
+		},
+		{
+			name:     "other kinds copy every field but metadata and status",
+			strategy: generic,
+			dst: map[string]interface{}{
+				"apiVersion": "example.com/v1",
+				"kind":       "Widget",
+				"metadata":   map[string]interface{}{"name": "copy"},
+				"spec":       map[string]interface{}{"size": int64(1)},
+				"dropped":    "value",
+			},
+			src: map[string]interface{}{
+				"apiVersion": "example.com/v1",
+				"kind":       "Widget",
+				"metadata":   map[string]interface{}{"name": "source"},
+				"spec":       map[string]interface{}{"size": int64(2)},
+				"status":     map[string]interface{}{"ready": true},
+			},
+			want: map[string]interface{}{
+				"apiVersion": "example.com/v1",
+				"kind":       "Widget",
+				"metadata":   map[string]interface{}{"name": "copy"},
+				"spec":       map[string]interface{}{"size": int64(2)},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dst := &unstructured.Unstructured{Object: c.dst}
+			src := &unstructured.Unstructured{Object: c.src}
+			c.strategy.Copy(dst, src)
+			if !reflect.DeepEqual(dst.Object, c.want) {
+				t.Errorf("Copy() = %v, want %v", dst.Object, c.want)
+			}
+		})
+	}
+
+	// the copy must not share maps with the source
+	dst := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	src := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"a": "b"}}}
+	ConfigMaps.Strategy.Copy(dst, src)
+	dst.Object["data"].(map[string]interface{})["a"] = "changed"
+	if src.Object["data"].(map[string]interface{})["a"] != "b" {
+		t.Errorf("Copy() aliases the source data")
+	}
+}
+
+func TestFieldStrategyChanged(t *testing.T) {
+	base := func() *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "source", "resourceVersion": "1"},
+			"data":     map[string]interface{}{"you": "only"},
+		}}
+		u.SetLabels(map[string]string{"app": "demo"})
+		u.SetAnnotations(map[string]string{ConfigSyncKey: "true"})
+		return u
+	}
+	cases := []struct {
+		name   string
+		update func(u *unstructured.Unstructured)
+		want   bool
+	}{
+		{name: "unchanged", update: func(u *unstructured.Unstructured) {}},
+		{name: "resourceVersion only", update: func(u *unstructured.Unstructured) { u.SetResourceVersion("2") }},
+		{name: "status only", update: func(u *unstructured.Unstructured) { u.Object["status"] = "ignored" }},
+		{name: "labels", update: func(u *unstructured.Unstructured) { u.SetLabels(nil) }, want: true},
+		{name: "annotations", update: func(u *unstructured.Unstructured) {
+			u.SetAnnotations(map[string]string{ConfigSyncKey: "app=demo"})
+		}, want: true},
+		{name: "data", update: func(u *unstructured.Unstructured) {
+			u.Object["data"] = map[string]interface{}{"you": "twice"}
+		}, want: true},
+		{name: "binaryData added", update: func(u *unstructured.Unstructured) {
+			u.Object["binaryData"] = map[string]interface{}{"bin": "AA=="}
+		}, want: true},
+		{name: "unsynced field", update: func(u *unstructured.Unstructured) { u.Object["immutable"] = true }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			nu := base()
+			c.update(nu)
+			if got := ConfigMaps.Strategy.Changed(base(), nu); got != c.want {
+				t.Errorf("Changed() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
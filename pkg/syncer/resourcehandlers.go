@@ -18,153 +18,134 @@ package syncer
 
 import (
 	"reflect"
+	"strings"
 
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/tools/queue"
 )
 
-func (s *ConfigSyncer) ConfigMapHandler() cache.ResourceEventHandler {
-	return &configmapSyncer{s}
+// resourceSyncer holds the queue and cache of a synced resource.
+type resourceSyncer struct {
+	Resource
+	queue       *queue.Worker
+	indexer     cache.Indexer
+	copyQueue   *queue.Worker
+	copyIndexer cache.Indexer
 }
 
-type configmapSyncer struct {
-	*ConfigSyncer
+func (s *ConfigSyncer) newResourceSyncer(r Resource, maxNumRequeues, numThreads int) *resourceSyncer {
+	rs := &resourceSyncer{Resource: r}
+	rs.queue = queue.New(r.Kind, maxNumRequeues, numThreads, func(key string) error {
+		return s.reconcileResource(rs, key)
+	})
+	rs.copyQueue = queue.New(r.Kind+"Copy", maxNumRequeues, numThreads, func(key string) error {
+		return s.reconcileCopy(rs, key)
+	})
+	return rs
 }
 
-var _ cache.ResourceEventHandler = &configmapSyncer{}
-
-func (s *configmapSyncer) OnAdd(obj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	if res, ok := obj.(*core.ConfigMap); ok {
-		if err := s.SyncConfigMap(res); err != nil {
-			klog.Errorln(err)
-		}
-	}
-}
-
-func (s *configmapSyncer) OnUpdate(oldObj, newObj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	oldRes, ok := oldObj.(*core.ConfigMap)
-	if !ok {
+func (s *ConfigSyncer) SetupResourceInformer(gvr schema.GroupVersionResource, informer cache.SharedIndexInformer) {
+	r := s.resourceFor(gvr)
+	if r == nil {
+		klog.Errorf("resource %s is not synced", gvr)
 		return
 	}
-	newRes, ok := newObj.(*core.ConfigMap)
-	if !ok {
-		return
+	if err := informer.AddIndexers(cache.Indexers{
+		SyncAnnotationIndex: syncAnnotationIndexFunc,
+		TransformIndex:      transformIndexFunc,
+	}); err != nil {
+		klog.Errorf("failed to add indexers for %s: %v", gvr, err)
 	}
-	if !reflect.DeepEqual(oldRes.Labels, newRes.Labels) ||
-		!reflect.DeepEqual(oldRes.Annotations, newRes.Annotations) ||
-		!reflect.DeepEqual(oldRes.Data, newRes.Data) ||
-		!reflect.DeepEqual(oldRes.BinaryData, newRes.BinaryData) {
-
-		if err := s.SyncConfigMap(newRes); err != nil {
-			klog.Errorln(err)
+	r.indexer = informer.GetIndexer()
+	informer.AddEventHandler(queue.NewEventHandler(r.queue.GetQueue(), func(oldObj, newObj interface{}) bool {
+		oldRes, ok := oldObj.(*unstructured.Unstructured)
+		if !ok {
+			return false
 		}
-	}
-}
-
-func (s *configmapSyncer) OnDelete(obj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	if res, ok := obj.(*core.ConfigMap); ok {
-		if err := s.SyncDeletedConfigMap(res); err != nil {
-			klog.Errorln(err)
+		newRes, ok := newObj.(*unstructured.Unstructured)
+		if !ok {
+			return false
 		}
-	}
+		// retry on resync until the copies of a deleted source are gone
+		return r.Strategy.Changed(oldRes, newRes) || newRes.GetDeletionTimestamp() != nil && hasFinalizer(newRes)
+	}, core.NamespaceAll))
 }
 
-func (s *ConfigSyncer) SecretHandler() cache.ResourceEventHandler {
-	return &secretSyncer{s}
-}
-
-type secretSyncer struct {
-	*ConfigSyncer
-}
-
-var _ cache.ResourceEventHandler = &secretSyncer{}
-
-func (s *secretSyncer) OnAdd(obj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	if res, ok := obj.(*core.Secret); ok {
-		if err := s.SyncSecret(res); err != nil {
-			klog.Errorln(err)
-		}
+func (s *ConfigSyncer) reconcileResource(r *resourceSyncer, key string) error {
+	obj, exists, err := r.indexer.GetByKey(key)
+	if err != nil {
+		return err
 	}
-}
 
-func (s *secretSyncer) OnUpdate(oldObj, newObj interface{}) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
-	oldRes, ok := oldObj.(*core.Secret)
-	if !ok {
-		return
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
 	}
-	newRes, ok := newObj.(*core.Secret)
-	if !ok {
-		return
+	defer s.enqueueSyncPoliciesFor(r.SourceKind(), namespace)
+	if r.GroupVersionResource == ConfigMaps.GroupVersionResource {
+		// the configmap may hold a transform script
+		defer s.enqueueTransformUsers(namespace, name)
 	}
-	if !reflect.DeepEqual(oldRes.Labels, newRes.Labels) ||
-		!reflect.DeepEqual(oldRes.Annotations, newRes.Annotations) ||
-		!reflect.DeepEqual(oldRes.Data, newRes.Data) {
 
-		if err := s.SyncSecret(newRes); err != nil {
-			klog.Errorln(err)
-		}
+	if !exists {
+		klog.V(4).Infof("%s %s does not exist anymore", strings.ToLower(r.Kind), key)
+		src := &unstructured.Unstructured{}
+		src.SetGroupVersionKind(r.GroupVersionKind())
+		src.SetNamespace(namespace)
+		src.SetName(name)
+		return s.syncDeleted(r, src)
 	}
-}
-
-func (s *secretSyncer) OnDelete(obj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	if res, ok := obj.(*core.Secret); ok {
-		if err := s.SyncDeletedSecret(res); err != nil {
-			klog.Infoln(err)
+	src := obj.(*unstructured.Unstructured)
+	if isSyncStatus(src) {
+		return nil
+	}
+	if src.GetDeletionTimestamp() != nil {
+		if hasFinalizer(src) {
+			return s.finalize(r, src.DeepCopy())
 		}
+		return nil
 	}
+	src, err = s.addFinalizer(r, src.DeepCopy())
+	if err != nil {
+		return err
+	}
+	if err := s.sync(r, src.DeepCopy()); err != nil {
+		return err
+	}
+	return s.removeFinalizer(r, src)
 }
 
-func (s *ConfigSyncer) NamespaceHandler() cache.ResourceEventHandler {
-	return &nsSyncer{s}
-}
-
-type nsSyncer struct {
-	*ConfigSyncer
+func (s *ConfigSyncer) SetupNamespaceInformer(informer cache.SharedIndexInformer) {
+	s.nsIndexer = informer.GetIndexer()
+	informer.AddEventHandler(queue.NewEventHandler(s.nsQueue.GetQueue(), func(oldObj, newObj interface{}) bool {
+		old := oldObj.(*core.Namespace)
+		nu := newObj.(*core.Namespace)
+		return !reflect.DeepEqual(old.Labels, nu.Labels) ||
+			old.Annotations[NamespaceExcludeKey] != nu.Annotations[NamespaceExcludeKey]
+	}, core.NamespaceAll))
 }
 
-var _ cache.ResourceEventHandler = &secretSyncer{}
-
-func (s *nsSyncer) OnAdd(obj interface{}) {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-
-	if res, ok := obj.(*core.Namespace); ok {
-		if err := s.SyncIntoNamespace(res.Name); err != nil {
-			klog.Errorln(err)
-		}
+func (s *ConfigSyncer) reconcileNamespace(key string) error {
+	_, exists, err := s.nsIndexer.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// copies are removed along with the namespace
+		return nil
 	}
-}
 
-func (s *nsSyncer) OnUpdate(oldObj, newObj interface{}) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
-	old := oldObj.(*core.Namespace)
-	nu := newObj.(*core.Namespace)
-	if !reflect.DeepEqual(old.Labels, nu.Labels) {
-		if err := s.SyncIntoNamespace(nu.Name); err != nil {
-			klog.Errorln(err)
-		}
-	}
+	// the namespace may no longer be selected by the sources of its copies
+	s.enqueueSourcesWithCopiesIn(key)
+	return s.SyncIntoNamespace(key)
 }
-
-func (s *nsSyncer) OnDelete(obj interface{}) {}
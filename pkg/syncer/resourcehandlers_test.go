@@ -0,0 +1,112 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// failingCreates makes the first n creates of ConfigMaps fail, or every create if n is negative.
+type failingCreates struct {
+	lock     sync.Mutex
+	n        int
+	attempts int
+}
+
+func (f *failingCreates) react(clienttesting.Action) (bool, runtime.Object, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.attempts++
+	if f.n == 0 {
+		return false, nil, nil
+	}
+	f.n--
+	return true, nil, errors.New("etcdserver: request timed out")
+}
+
+func (f *failingCreates) count() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.attempts
+}
+
+func TestResourceQueueRetriesFailedSyncs(t *testing.T) {
+	ts := newTestSyncer(t, Options{MaxNumRequeues: 5, NumThreads: 1},
+		newNamespace("demo", nil, nil),
+		newNamespace("team", nil, nil),
+		newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"}),
+	)
+	creates := &failingCreates{n: 2}
+	ts.dc.PrependReactor("create", "configmaps", creates.react)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+	r.queue.Run(stopCh)
+	r.queue.GetQueue().Add("demo/omni")
+
+	err := wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		_, err := ts.dc.Resource(ConfigMaps.GroupVersionResource).Namespace("team").Get(context.TODO(), "omni", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("copy was not created after failed attempts: %v", err)
+	}
+	if n := creates.count(); n != 3 {
+		t.Errorf("create was attempted %d times, want 3", n)
+	}
+}
+
+func TestResourceQueueDropsKeyAfterMaxRequeues(t *testing.T) {
+	ts := newTestSyncer(t, Options{MaxNumRequeues: 2, NumThreads: 1},
+		newNamespace("demo", nil, nil),
+		newNamespace("team", nil, nil),
+		newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"}),
+	)
+	creates := &failingCreates{n: -1}
+	ts.dc.PrependReactor("create", "configmaps", creates.react)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+	r.queue.Run(stopCh)
+	r.queue.GetQueue().Add("demo/omni")
+
+	err := wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		return creates.count() >= 3, nil
+	})
+	if err != nil {
+		t.Fatalf("sync was not retried: %v", err)
+	}
+	// the rate limiter would have requeued the key within 20ms
+	time.Sleep(200 * time.Millisecond)
+	if n := creates.count(); n != 3 {
+		t.Errorf("create was attempted %d times, want 3", n)
+	}
+	if n := r.queue.GetQueue().NumRequeues("demo/omni"); n != 0 {
+		t.Errorf("key was not forgotten, %d requeues recorded", n)
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	kutil "kmodules.xyz/client-go"
+	core_util "kmodules.xyz/client-go/core/v1"
+)
+
+const (
+	// Labels of the companion ConfigMap holding the sync status of a source
+	StatusKindLabelKey = "kubed.appscode.com/status.kind"
+	StatusNameLabelKey = "kubed.appscode.com/status.name"
+
+	SyncStatusKey = "status.json"
+)
+
+// syncReport collects the per-target results of syncing a single source.
+type syncReport struct {
+	resourceVersion string
+	targets         map[string]api.TargetStatus
+	pruned          map[string]bool
+}
+
+func newSyncReport(resourceVersion string) *syncReport {
+	return &syncReport{
+		resourceVersion: resourceVersion,
+		targets:         map[string]api.TargetStatus{},
+		pruned:          map[string]bool{},
+	}
+}
+
+func targetKey(ctx, namespace string) string {
+	return ctx + "/" + namespace
+}
+
+func (r *syncReport) synced(ctx, namespace string) {
+	r.targets[targetKey(ctx, namespace)] = api.TargetStatus{
+		Context:         ctx,
+		Namespace:       namespace,
+		Phase:           api.TargetPhaseSynced,
+		ResourceVersion: r.resourceVersion,
+	}
+}
+
+func (r *syncReport) failed(ctx, namespace string, err error) {
+	r.targets[targetKey(ctx, namespace)] = api.TargetStatus{
+		Context:   ctx,
+		Namespace: namespace,
+		Phase:     api.TargetPhaseFailed,
+		LastError: err.Error(),
+	}
+}
+
+func (r *syncReport) skipped(ctx, namespace, reason string) {
+	r.targets[targetKey(ctx, namespace)] = api.TargetStatus{
+		Context:   ctx,
+		Namespace: namespace,
+		Phase:     api.TargetPhaseSkipped,
+		LastError: reason,
+	}
+}
+
+func (r *syncReport) prune(ctx, namespace string) {
+	r.pruned[targetKey(ctx, namespace)] = true
+}
+
+func (r *syncReport) empty() bool {
+	return len(r.targets) == 0 && len(r.pruned) == 0
+}
+
+// apply merges the report into a previously recorded status.
+// If partial is false, targets missing from the report are dropped.
+func (r *syncReport) apply(status *api.SyncStatus, partial bool) {
+	targets := map[string]api.TargetStatus{}
+	if partial {
+		for _, t := range status.Targets {
+			targets[targetKey(t.Context, t.Namespace)] = t
+		}
+	}
+	for k, t := range r.targets {
+		if t.Phase == api.TargetPhaseFailed {
+			// keep the version that was last synced successfully
+			if old, ok := targets[k]; ok {
+				t.ResourceVersion = old.ResourceVersion
+			}
+		}
+		targets[k] = t
+	}
+	for k := range r.pruned {
+		// a copy may be replaced by one with a different name in the same namespace
+		if _, synced := r.targets[k]; !synced {
+			delete(targets, k)
+		}
+	}
+
+	status.ResourceVersion = r.resourceVersion
+	status.Targets = make([]api.TargetStatus, 0, len(targets))
+	for _, t := range targets {
+		status.Targets = append(status.Targets, t)
+	}
+	sort.Slice(status.Targets, func(i, j int) bool {
+		if status.Targets[i].Context != status.Targets[j].Context {
+			return status.Targets[i].Context < status.Targets[j].Context
+		}
+		return status.Targets[i].Namespace < status.Targets[j].Namespace
+	})
+}
+
+// syncStatusName returns the name of the ConfigMap holding the sync status of a source. Long source
+// names are truncated and suffixed with a hash of the full name, so that the result is a valid object name.
+func syncStatusName(kind, name string) string {
+	suffix := fmt.Sprintf(".%s.sync-status", strings.ToLower(kind))
+	if len(name)+len(suffix) <= validation.DNS1123SubdomainMaxLength {
+		return name + suffix
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	hash := fmt.Sprintf("-%08x", h.Sum32())
+	prefix := strings.TrimRight(name[:validation.DNS1123SubdomainMaxLength-len(suffix)-len(hash)], ".-")
+	return prefix + hash + suffix
+}
+
+// readSyncStatus returns the status recorded for a source, or nil if no status was recorded yet.
+func (s *ConfigSyncer) readSyncStatus(src *unstructured.Unstructured) (*api.SyncStatus, error) {
+	obj, exists, err := s.resourceFor(ConfigMaps.GroupVersionResource).indexer.GetByKey(src.GetNamespace() + "/" + syncStatusName(src.GetKind(), src.GetName()))
+	if err != nil || !exists {
+		return nil, err
+	}
+	var status api.SyncStatus
+	data, found, err := unstructured.NestedString(obj.(*unstructured.Unstructured).Object, "data", SyncStatusKey)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			return nil, err
+		}
+	}
+	return &status, nil
+}
+
+// writeSyncStatus records the report in a ConfigMap next to the source. The ConfigMap is owned by the
+// source, so it is garbage collected along with it. Set partial if the report does not cover every target.
+func (s *ConfigSyncer) writeSyncStatus(src *unstructured.Unstructured, report *syncReport, partial bool) error {
+	if src.GetUID() == "" {
+		// source is gone, its status will be garbage collected
+		return nil
+	}
+
+	status, err := s.readSyncStatus(src)
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		if report.empty() {
+			return nil
+		}
+		status = &api.SyncStatus{}
+	}
+	report.apply(status, partial)
+	setManagedCopies(src.GetKind(), src.GetNamespace(), src.GetName(), status)
+
+	name := syncStatusName(src.GetKind(), src.GetName())
+	if len(status.Targets) == 0 {
+		err := s.kubeClient.CoreV1().ConfigMaps(src.GetNamespace()).Delete(context.TODO(), name, metav1.DeleteOptions{DryRun: s.dryRunOpts()})
+		if kerr.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: src.GetNamespace(),
+	}
+	_, _, err = core_util.CreateOrPatchConfigMap(context.TODO(), s.kubeClient, meta, func(obj *core.ConfigMap) *core.ConfigMap {
+		obj.Labels = map[string]string{
+			StatusKindLabelKey: src.GetKind(),
+		}
+		// sources with names longer than a label value are identified by the owner reference only
+		if len(validation.IsValidLabelValue(src.GetName())) == 0 {
+			obj.Labels[StatusNameLabelKey] = src.GetName()
+		}
+		core_util.EnsureOwnerReference(&obj.ObjectMeta, metav1.NewControllerRef(src, src.GroupVersionKind()))
+		obj.Data = map[string]string{
+			SyncStatusKey: string(data),
+		}
+		return obj
+	}, metav1.PatchOptions{DryRun: s.dryRunOpts()})
+	return err
+}
+
+func isSyncStatus(obj metav1.Object) bool {
+	_, ok := obj.GetLabels()[StatusKindLabelKey]
+	return ok
+}
+
+func describeTarget(ctx, namespace string) string {
+	if ctx == "" {
+		return "namespace " + namespace
+	}
+	return fmt.Sprintf("namespace %s in context %s", namespace, ctx)
+}
+
+func (s *ConfigSyncer) recordSynced(src runtime.Object, report *syncReport, ctx, namespace string, verb kutil.VerbType) {
+	report.synced(ctx, namespace)
+	kind, srcNs := sourceLabels(src)
+	syncAttempts.WithLabelValues(kind, srcNs, ctx).Inc()
+	if verb == kutil.VerbUnchanged {
+		return
+	}
+	syncUpserts.WithLabelValues(kind, srcNs, ctx).Inc()
+	if s.dryRun {
+		s.logPlan(string(verb), src, ctx, namespace)
+		return
+	}
+	s.recorder.Eventf(src, core.EventTypeNormal, eventer.EventReasonSynced, "Synced into %s", describeTarget(ctx, namespace))
+}
+
+func (s *ConfigSyncer) recordSyncFailed(src runtime.Object, report *syncReport, ctx, namespace string, err error) {
+	report.failed(ctx, namespace, err)
+	kind, srcNs := sourceLabels(src)
+	syncAttempts.WithLabelValues(kind, srcNs, ctx).Inc()
+	syncFailures.WithLabelValues(kind, srcNs, ctx).Inc()
+	s.recorder.Eventf(src, core.EventTypeWarning, eventer.EventReasonSyncFailed, "Failed to sync into %s: %v", describeTarget(ctx, namespace), err)
+}
+
+func (s *ConfigSyncer) recordSkipped(src runtime.Object, report *syncReport, ctx, namespace, reason string) {
+	report.skipped(ctx, namespace, reason)
+	kind, srcNs := sourceLabels(src)
+	syncAttempts.WithLabelValues(kind, srcNs, ctx).Inc()
+	syncSkips.WithLabelValues(kind, srcNs, ctx).Inc()
+	s.recorder.Eventf(src, core.EventTypeWarning, eventer.EventReasonSyncSkipped, "Skipped %s: %s", describeTarget(ctx, namespace), reason)
+}
+
+func (s *ConfigSyncer) recordPruned(src runtime.Object, report *syncReport, ctx, namespace string) {
+	report.prune(ctx, namespace)
+	kind, srcNs := sourceLabels(src)
+	syncAttempts.WithLabelValues(kind, srcNs, ctx).Inc()
+	syncDeletes.WithLabelValues(kind, srcNs, ctx).Inc()
+	if s.dryRun {
+		s.logPlan("deleted", src, ctx, namespace)
+		return
+	}
+	s.recorder.Eventf(src, core.EventTypeNormal, eventer.EventReasonPruned, "Deleted copy from %s", describeTarget(ctx, namespace))
+}
+
+// logPlan logs a change that was only sent to the API server as a dry run.
+func (s *ConfigSyncer) logPlan(action string, src runtime.Object, ctx, namespace string) {
+	kind, srcNs := sourceLabels(src)
+	name := ""
+	if obj, ok := src.(metav1.Object); ok {
+		name = obj.GetName()
+	}
+	klog.InfoS("Dry run", "action", action, "kind", kind, "source", srcNs+"/"+name, "context", ctx, "namespace", namespace)
+}
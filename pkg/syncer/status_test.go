@@ -0,0 +1,208 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestSyncReportApply(t *testing.T) {
+	previous := func() *api.SyncStatus {
+		return &api.SyncStatus{
+			ResourceVersion: "1",
+			Targets: []api.TargetStatus{
+				{Namespace: "a", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+				{Namespace: "b", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+				{Context: "remote", Namespace: "a", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+			},
+		}
+	}
+
+	cases := []struct {
+		name    string
+		report  func(r *syncReport)
+		partial bool
+		want    []api.TargetStatus
+	}{
+		{
+			name: "full report drops missing targets",
+			report: func(r *syncReport) {
+				r.synced("", "a")
+			},
+			want: []api.TargetStatus{
+				{Namespace: "a", Phase: api.TargetPhaseSynced, ResourceVersion: "2"},
+			},
+		},
+		{
+			name: "partial report keeps other targets",
+			report: func(r *syncReport) {
+				r.synced("", "c")
+			},
+			partial: true,
+			want: []api.TargetStatus{
+				{Namespace: "a", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+				{Namespace: "b", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+				{Namespace: "c", Phase: api.TargetPhaseSynced, ResourceVersion: "2"},
+				{Context: "remote", Namespace: "a", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+			},
+		},
+		{
+			name: "failure keeps the last synced version",
+			report: func(r *syncReport) {
+				r.failed("", "a", errors.New("boom"))
+			},
+			partial: true,
+			want: []api.TargetStatus{
+				{Namespace: "a", Phase: api.TargetPhaseFailed, ResourceVersion: "1", LastError: "boom"},
+				{Namespace: "b", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+				{Context: "remote", Namespace: "a", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+			},
+		},
+		{
+			name: "pruned targets are dropped",
+			report: func(r *syncReport) {
+				r.prune("", "b")
+				r.prune("remote", "a")
+			},
+			partial: true,
+			want: []api.TargetStatus{
+				{Namespace: "a", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+			},
+		},
+		{
+			name: "copy replaced in the same namespace",
+			report: func(r *syncReport) {
+				r.prune("", "a")
+				r.synced("", "a")
+			},
+			partial: true,
+			want: []api.TargetStatus{
+				{Namespace: "a", Phase: api.TargetPhaseSynced, ResourceVersion: "2"},
+				{Namespace: "b", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+				{Context: "remote", Namespace: "a", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+			},
+		},
+		{
+			name: "skipped",
+			report: func(r *syncReport) {
+				r.skipped("remote", "a", "namespace a opted out of syncs")
+			},
+			partial: true,
+			want: []api.TargetStatus{
+				{Namespace: "a", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+				{Namespace: "b", Phase: api.TargetPhaseSynced, ResourceVersion: "1"},
+				{Context: "remote", Namespace: "a", Phase: api.TargetPhaseSkipped, LastError: "namespace a opted out of syncs"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			report := newSyncReport("2")
+			c.report(report)
+			status := previous()
+			report.apply(status, c.partial)
+			if status.ResourceVersion != "2" {
+				t.Errorf("ResourceVersion = %q, want 2", status.ResourceVersion)
+			}
+			if !reflect.DeepEqual(status.Targets, c.want) {
+				t.Errorf("Targets = %+v, want %+v", status.Targets, c.want)
+			}
+		})
+	}
+}
+
+func TestSyncStatusName(t *testing.T) {
+	long := strings.Repeat("a", validation.DNS1123SubdomainMaxLength)
+	cases := []struct {
+		name string
+		kind string
+		src  string
+		want string
+	}{
+		{name: "short", kind: "ConfigMap", src: "omni", want: "omni.configmap.sync-status"},
+		{name: "fits exactly", kind: "Secret", src: long[:validation.DNS1123SubdomainMaxLength-len(".secret.sync-status")]},
+		{name: "too long", kind: "ConfigMap", src: long},
+		{name: "too long ending in a dash", kind: "ConfigMap", src: long[:200] + "-" + long[:100]},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := syncStatusName(c.kind, c.src)
+			if c.want != "" && got != c.want {
+				t.Errorf("syncStatusName() = %q, want %q", got, c.want)
+			}
+			if msgs := validation.IsDNS1123Subdomain(got); len(msgs) > 0 {
+				t.Errorf("syncStatusName() = %q is not a valid name: %v", got, msgs)
+			}
+			if !strings.HasSuffix(got, "."+strings.ToLower(c.kind)+".sync-status") {
+				t.Errorf("syncStatusName() = %q lacks the kind suffix", got)
+			}
+		})
+	}
+
+	// truncated names of different sources must not collide
+	a := syncStatusName("ConfigMap", long+"a")
+	b := syncStatusName("ConfigMap", long+"b")
+	if a == b {
+		t.Errorf("syncStatusName() = %q for different sources", a)
+	}
+}
+
+func TestWriteSyncStatus(t *testing.T) {
+	src := newConfigMap("demo", strings.Repeat("a", validation.LabelValueMaxLength+1), nil)
+	ts := newTestSyncer(t, Options{}, src)
+	u := toUnstructured(t, src)
+
+	report := newSyncReport("2")
+	report.synced("", "team")
+	if err := ts.writeSyncStatus(u, report, false); err != nil {
+		t.Fatal(err)
+	}
+	status, err := ts.kc.CoreV1().ConfigMaps("demo").Get(context.TODO(), syncStatusName("ConfigMap", src.Name), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSyncStatus(status) {
+		t.Errorf("status ConfigMap lacks the %s label", StatusKindLabelKey)
+	}
+	if _, ok := status.Labels[StatusNameLabelKey]; ok {
+		t.Errorf("status ConfigMap has an invalid %s label", StatusNameLabelKey)
+	}
+	if len(status.OwnerReferences) != 1 || status.OwnerReferences[0].UID != src.UID {
+		t.Errorf("status ConfigMap is not owned by the source: %v", status.OwnerReferences)
+	}
+	if !strings.Contains(status.Data[SyncStatusKey], `"namespace":"team"`) {
+		t.Errorf("status = %s, want the team namespace", status.Data[SyncStatusKey])
+	}
+
+	// a source without targets has no status
+	ts.cache(t, status)
+	if err := ts.writeSyncStatus(u, newSyncReport("3"), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.kc.CoreV1().ConfigMaps("demo").Get(context.TODO(), status.Name, metav1.GetOptions{}); err == nil {
+		t.Errorf("status ConfigMap was not deleted")
+	}
+}
@@ -0,0 +1,413 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+	"kubeops.dev/config-syncer/pkg/eventer"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+	kutil "kmodules.xyz/client-go"
+	dynamic_util "kmodules.xyz/client-go/dynamic"
+)
+
+func (s *ConfigSyncer) sync(r *resourceSyncer, src *unstructured.Unstructured) error {
+	opts := s.syncOptionsFor(r.SourceKind(), src)
+	if !s.policy.AllowsSource(src.GetNamespace()) {
+		if len(opts.NamespaceSelectors) > 0 || opts.Contexts.Len() > 0 {
+			s.recorder.Eventf(src, core.EventTypeWarning, eventer.EventReasonSyncRefused, "Namespace %s may not be a sync source", src.GetNamespace())
+		}
+		// delete the copies that were made before the namespace was disallowed
+		opts = SyncOptions{}
+	}
+	spec, err := s.prepareSource(r, src, opts)
+	if err != nil {
+		s.recorder.Eventf(src, core.EventTypeWarning, eventer.EventReasonSyncFailed, "Invalid sync options: %v", err)
+		return err
+	}
+	report := newSyncReport(src.GetResourceVersion())
+
+	newNs := sets.NewString()
+	if len(opts.NamespaceSelectors) > 0 { // delete that were in old-ns but not in new-ns and upsert to new-ns
+		ns, err := s.namespacesForSelectors(r.Kind, opts.NamespaceSelectors, src)
+		if err != nil {
+			return err
+		}
+		if ns, err = s.authorizeNamespaces(r, src, ns, report); err != nil {
+			return err
+		}
+		klog.Infof("%s %s/%s will be synced into namespaces %v if needed", strings.ToLower(r.Kind), src.GetNamespace(), src.GetName(), ns.List())
+		newNs = ns
+	} // else no sync, delete that were previously added
+	if spec.name == src.GetName() {
+		// the source is never copied over itself
+		newNs.Delete(src.GetNamespace())
+	}
+	contexts := s.authorizeContexts(r, src, opts.Contexts, report)
+	if n := newNs.Len() + contexts.Len(); s.policy.ExceedsFanOut(n) {
+		// leave the existing copies alone until the source is fixed
+		s.recorder.Eventf(src, core.EventTypeWarning, eventer.EventReasonSyncRefused, "Refused to sync into %d targets, at most %d are allowed", n, s.policy.MaxFanOut)
+		reason := fmt.Sprintf("source selects %d targets, at most %d are allowed", n, s.policy.MaxFanOut)
+		for _, ns := range newNs.List() {
+			report.skipped("", ns, reason)
+		}
+		for _, ctx := range contexts.List() {
+			namespace := src.GetNamespace()
+			if c, found := s.contexts[ctx]; found && c.Namespace != "" {
+				namespace = c.Namespace
+			}
+			report.skipped(ctx, namespace, reason)
+		}
+		return s.writeSyncStatus(src, report, false)
+	}
+
+	var errs []error
+	if err := s.syncIntoNamespaces(r, s.dynamicClient, src, spec, newNs, true, "", report); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.syncIntoContexts(r, src, spec, contexts, report); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.writeSyncStatus(src, report, false); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// copySpec describes how the copies of a source are built.
+type copySpec struct {
+	name           string
+	transform      *transform
+	template       bool
+	conflictPolicy api.ConflictPolicy
+}
+
+// prepareSource applies the key filter and mapping of opts to src and returns the spec of its copies.
+func (s *ConfigSyncer) prepareSource(r *resourceSyncer, src *unstructured.Unstructured, opts SyncOptions) (*copySpec, error) {
+	if err := r.Strategy.MapKeys(src, opts.Keys); err != nil {
+		return nil, err
+	}
+	spec := &copySpec{name: src.GetName(), conflictPolicy: s.conflictPolicy}
+	if opts.ConflictPolicy != "" {
+		if err := ValidateConflictPolicy(opts.ConflictPolicy); err != nil {
+			return nil, err
+		}
+		spec.conflictPolicy = opts.ConflictPolicy
+	}
+	if opts.TargetName != "" {
+		if msgs := validation.IsDNS1123Subdomain(opts.TargetName); len(msgs) > 0 {
+			return nil, errors.Errorf("invalid target name %q: %s", opts.TargetName, strings.Join(msgs, ", "))
+		}
+		spec.name = opts.TargetName
+	}
+	if opts.Transform != nil {
+		t, err := s.loadTransform(r, src.GetNamespace(), opts.Transform)
+		if err != nil {
+			return nil, err
+		}
+		spec.transform = t
+	}
+	if opts.Template {
+		if r.GroupVersionResource != ConfigMaps.GroupVersionResource {
+			return nil, errors.Errorf("templates are not supported for %s", r.Kind)
+		}
+		spec.template = true
+	}
+	return spec, nil
+}
+
+// source deleted, delete that were previously added
+func (s *ConfigSyncer) syncDeleted(r *resourceSyncer, src *unstructured.Unstructured) error {
+	forgetManagedCopies(src.GetKind(), src.GetNamespace(), src.GetName())
+	report := newSyncReport(src.GetResourceVersion())
+	if err := s.syncIntoNamespaces(r, s.dynamicClient, src, &copySpec{name: src.GetName()}, sets.NewString(), true, "", report); err != nil {
+		return err
+	}
+	return s.syncIntoContexts(r, src, &copySpec{name: src.GetName()}, sets.NewString(), report)
+}
+
+func (s *ConfigSyncer) syncIntoContexts(r *resourceSyncer, src *unstructured.Unstructured, spec *copySpec, contexts sets.String, report *syncReport) error {
+	var errs []error
+
+	// validate contexts specified via annotation, skip invalid ones
+	taken := map[string]struct{}{}
+	valid := sets.NewString()
+	for _, ctx := range contexts.List() {
+		context, found := s.contexts[ctx]
+		if !found {
+			err := errors.Errorf("context %s not found in kubeconfig file", ctx)
+			s.recordSyncFailed(src, report, ctx, src.GetNamespace(), err)
+			errs = append(errs, err)
+			continue
+		}
+		if _, found = taken[context.Address]; found {
+			err := errors.Errorf("multiple contexts poniting same cluster")
+			s.recordSyncFailed(src, report, ctx, src.GetNamespace(), err)
+			errs = append(errs, err)
+			continue
+		}
+		namespace := context.Namespace
+		if namespace == "" {
+			namespace = src.GetNamespace()
+		}
+		if s.policy.DeniesTarget(namespace) {
+			// copies made before the namespace was denied are deleted below
+			s.recordSkipped(src, report, ctx, namespace, "namespace "+namespace+" may not receive copies")
+			continue
+		}
+		taken[context.Address] = struct{}{}
+		valid.Insert(ctx)
+	}
+
+	// sync to contexts specified via annotation, skip unhealthy contexts until they recover
+	for _, ctx := range valid.List() {
+		if err := s.contextHealthy(ctx); err != nil {
+			s.recordSyncFailed(src, report, ctx, src.GetNamespace(), err)
+			s.markPending(ctx, r, src)
+			continue
+		}
+		context := s.contexts[ctx]
+		if context.Namespace == "" { // use source namespace if not specified via context
+			context.Namespace = src.GetNamespace()
+		}
+		newNs := sets.NewString(context.Namespace)
+		if excluded, err := contextExcludes(context.Client, context.Namespace, r.Kind, src); err != nil {
+			s.recordSyncFailed(src, report, ctx, context.Namespace, err)
+			errs = append(errs, err)
+			continue
+		} else if excluded {
+			// delete the copy made before the namespace opted out
+			s.recordSkipped(src, report, ctx, context.Namespace, "namespace "+context.Namespace+" opted out of syncs")
+			newNs = sets.NewString()
+		}
+		err := s.syncIntoNamespaces(r, context.Dynamic, src, spec, newNs, false, ctx, report)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// delete from other contexts, so that failed deletes are retried
+	for ctxName, ctx := range s.contexts {
+		if _, found := taken[ctx.Address]; !found {
+			taken[ctx.Address] = struct{}{} // to avoid deleting form same cluster twice
+			if err := s.contextHealthy(ctxName); err != nil {
+				s.markPending(ctxName, r, src)
+				continue
+			}
+			err := s.syncIntoNamespaces(r, ctx.Dynamic, src, spec, sets.NewString(), false, ctxName, report)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// upsert into newNs set as spec.name, delete every other copy
+// use skipSrcNs = true for sync in source cluster
+func (s *ConfigSyncer) syncIntoNamespaces(r *resourceSyncer, dc dynamic.Interface, src *unstructured.Unstructured, spec *copySpec, newNs sets.String, skipSrcNs bool, ctx string, report *syncReport) error {
+	var copies []metav1.Object
+	var err error
+	if ctx == "" && r.copyIndexer != nil {
+		copies, err = s.cachedCopiesOf(r, src)
+	} else {
+		// copies in remote clusters are not cached
+		copies, err = listCopies(dc, r, s.syncerLabelSelector(src.GetName(), src.GetNamespace(), s.clusterName))
+	}
+	if err != nil {
+		return err
+	}
+	if skipSrcNs && spec.name == src.GetName() {
+		// never overwrite the source
+		newNs.Delete(src.GetNamespace())
+	}
+
+	var errs []error
+	for _, c := range copies {
+		if c.GetName() == spec.name && newNs.Has(c.GetNamespace()) {
+			continue
+		}
+		if skipSrcNs && c.GetNamespace() == src.GetNamespace() && c.GetName() == src.GetName() {
+			continue
+		}
+		if isUnmanaged(c) {
+			s.recordSkipped(src, report, ctx, c.GetNamespace(), errUnmanaged.Error())
+			continue
+		}
+		if err := dc.Resource(r.GroupVersionResource).Namespace(c.GetNamespace()).Delete(context.TODO(), c.GetName(), metav1.DeleteOptions{DryRun: s.dryRunOpts()}); err != nil && !kerr.IsNotFound(err) {
+			s.recordSyncFailed(src, report, ctx, c.GetNamespace(), err)
+			errs = append(errs, err)
+			continue
+		}
+		s.recordPruned(src, report, ctx, c.GetNamespace())
+	}
+	for _, ns := range newNs.List() {
+		if _, err = s.upsert(r, dc, src, spec, ns, ctx, report); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// syncIntoNamespace upserts the copy of src into a namespace of the source cluster if the namespace is targeted.
+func (s *ConfigSyncer) syncIntoNamespace(r *resourceSyncer, src *unstructured.Unstructured, namespace *core.Namespace) (kutil.VerbType, error) {
+	opts := s.syncOptionsFor(r.SourceKind(), src)
+	if len(opts.NamespaceSelectors) == 0 || !s.policy.AllowsSource(src.GetNamespace()) || s.policy.DeniesTarget(namespace.Name) {
+		return kutil.VerbUnchanged, nil
+	}
+	if s.policy != nil && s.policy.MaxFanOut > 0 {
+		// the fan-out of the source can only be checked by a full sync
+		r.queue.GetQueue().Add(src.GetNamespace() + "/" + src.GetName())
+		return kutil.VerbUnchanged, nil
+	}
+	if namespace.Name == src.GetNamespace() && (opts.TargetName == "" || opts.TargetName == src.GetName()) {
+		return kutil.VerbUnchanged, nil
+	}
+	if Excludes(namespace, r.Kind, src) {
+		return kutil.VerbUnchanged, nil
+	}
+	if matched, err := SelectorsMatch(opts.NamespaceSelectors, namespace.Labels); err != nil {
+		return kutil.VerbUnchanged, err
+	} else if !matched {
+		return kutil.VerbUnchanged, nil
+	}
+
+	report := newSyncReport(src.GetResourceVersion())
+	spec, err := s.prepareSource(r, src, opts)
+	if err != nil {
+		s.recordSyncFailed(src, report, "", namespace.Name, err)
+		return kutil.VerbUnchanged, utilerrors.NewAggregate([]error{err, s.writeSyncStatus(src, report, true)})
+	}
+	if allowed, err := s.authorizeNamespaces(r, src, sets.NewString(namespace.Name), report); err != nil {
+		return kutil.VerbUnchanged, err
+	} else if allowed.Len() == 0 {
+		return kutil.VerbUnchanged, s.writeSyncStatus(src, report, true)
+	}
+	verb, err := s.upsert(r, s.dynamicClient, src, spec, namespace.Name, "", report)
+	if verb == kutil.VerbUnchanged && report.targets[targetKey("", namespace.Name)].Phase == api.TargetPhaseSynced {
+		// nothing to record
+		return verb, nil
+	}
+	return verb, utilerrors.NewAggregate([]error{err, s.writeSyncStatus(src, report, true)})
+}
+
+// upsert creates or patches the copy of src in namespace and returns whether the copy changed.
+func (s *ConfigSyncer) upsert(r *resourceSyncer, dc dynamic.Interface, src *unstructured.Unstructured, spec *copySpec, namespace, ctx string, report *syncReport) (kutil.VerbType, error) {
+	defer observeSyncDuration(r.Kind, src.GetNamespace(), ctx, time.Now())
+
+	desired := src
+	if spec.transform != nil || spec.template {
+		ns, err := s.targetNamespace(namespace, ctx)
+		if err == nil && spec.transform != nil {
+			desired, err = spec.transform.apply(r, desired, namespace, ns.Labels, ctx)
+		}
+		if err != nil {
+			s.recordSyncFailed(src, report, ctx, namespace, err)
+			return kutil.VerbUnchanged, err
+		}
+		if spec.template {
+			if desired, err = renderTemplates(desired, s.templateData(ns, ctx)); err != nil {
+				// retrying does not help until the source is fixed
+				s.recordSyncFailed(src, report, ctx, namespace, err)
+				return kutil.VerbUnchanged, nil
+			}
+		}
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:      spec.name,
+		Namespace: namespace,
+	}
+	var skipped string
+	_, verb, err := dynamic_util.CreateOrPatch(context.TODO(), dc, r.GroupVersionResource, meta, func(obj *unstructured.Unstructured) *unstructured.Unstructured {
+		// leave skipped objects unchanged, so that they are not patched
+		if conflicts(obj, s.syncerLabels(src.GetName(), src.GetNamespace(), s.clusterName), spec.conflictPolicy) {
+			skipped = fmt.Sprintf("existing object is not a copy and conflict policy is %s", spec.conflictPolicy)
+			return obj
+		}
+		if isUnmanaged(obj) {
+			skipped = errUnmanaged.Error()
+			return obj
+		}
+
+		// check origin cluster, if not match overwrite and create an event
+		if v, ok := obj.GetLabels()[OriginClusterLabelKey]; ok && v != s.clusterName {
+			s.recorder.Eventf(
+				src,
+				core.EventTypeWarning,
+				eventer.EventReasonOriginConflict,
+				"Origin cluster changed from %s in context %s", v, ctx,
+			)
+		}
+
+		obj.SetGroupVersionKind(src.GroupVersionKind())
+		r.Strategy.Copy(obj, desired)
+		obj.SetLabels(labels.Merge(desired.GetLabels(), s.syncerLabels(src.GetName(), src.GetNamespace(), s.clusterName)))
+
+		ref := core.ObjectReference{
+			APIVersion:      src.GetAPIVersion(),
+			Kind:            src.GetKind(),
+			Name:            src.GetName(),
+			Namespace:       src.GetNamespace(),
+			UID:             src.GetUID(),
+			ResourceVersion: src.GetResourceVersion(),
+		}
+		obj.SetAnnotations(s.syncerAnnotations(obj.GetAnnotations(), desired.GetAnnotations(), ref))
+
+		return obj
+	}, metav1.PatchOptions{DryRun: s.dryRunOpts(), FieldManager: FieldManager})
+	if err != nil {
+		s.recordSyncFailed(src, report, ctx, namespace, err)
+		return kutil.VerbUnchanged, err
+	}
+	if skipped != "" {
+		s.recordSkipped(src, report, ctx, namespace, skipped)
+		return kutil.VerbUnchanged, nil
+	}
+	s.recordSynced(src, report, ctx, namespace, verb)
+	return verb, nil
+}
+
+func listCopies(dc dynamic.Interface, r *resourceSyncer, selector string) ([]metav1.Object, error) {
+	objs, err := dc.Resource(r.GroupVersionResource).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+	copies := make([]metav1.Object, 0, len(objs.Items))
+	for i := range objs.Items {
+		copies = append(copies, &objs.Items[i])
+	}
+	return copies, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestSyncReportsCleanupErrorsOfOtherContexts(t *testing.T) {
+	src := newConfigMap("demo", "omni", nil)
+	ts := newTestSyncer(t, Options{}, newNamespace("demo", nil, nil), src)
+
+	remote := dynamicfake.NewSimpleDynamicClient(scheme.Scheme)
+	remote.PrependReactor("list", "configmaps", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	ts.lock.Lock()
+	ts.fileContexts = map[string]clusterContext{
+		"remote": {Client: kfake.NewSimpleClientset(), Dynamic: remote, Address: "remote:443"},
+	}
+	ts.rebuildContexts()
+	ts.lock.Unlock()
+
+	err := ts.sync(ts.resourceFor(ConfigMaps.GroupVersionResource), toUnstructured(t, src))
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("sync() = %v, want the error deleting copies from the remote context", err)
+	}
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	ts := newTestSyncer(t, Options{DryRun: true},
+		newNamespace("demo", nil, nil),
+		newNamespace("team", map[string]string{"app": "demo"}, nil),
+		newNamespace("old", nil, nil),
+		newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "app=demo"}),
+		newCopy("old", "omni", "demo", "omni"),
+	)
+	log := ts.recordWrites()
+
+	if err := ts.reconcileResource(ts.resourceFor(ConfigMaps.GroupVersionResource), "demo/omni"); err != nil {
+		t.Fatal(err)
+	}
+	if len(log.writes) > 0 {
+		t.Errorf("writes = %v, want none in dry run", log.writes)
+	}
+	want := []string{
+		"delete configmaps old/omni",
+		"create configmaps team/omni",
+		"create configmaps demo/" + syncStatusName("ConfigMap", "omni"),
+	}
+	if !reflect.DeepEqual(log.dryRuns, want) {
+		t.Errorf("dry runs = %v, want %v", log.dryRuns, want)
+	}
+	if events := ts.events(); len(events) > 0 {
+		t.Errorf("events = %v, want none in dry run", events)
+	}
+
+	dc := ts.dc.Resource(ConfigMaps.GroupVersionResource)
+	if _, err := dc.Namespace("team").Get(context.TODO(), "omni", metav1.GetOptions{}); !kerr.IsNotFound(err) {
+		t.Errorf("copy was created in dry run: %v", err)
+	}
+	if _, err := dc.Namespace("old").Get(context.TODO(), "omni", metav1.GetOptions{}); err != nil {
+		t.Errorf("copy was deleted in dry run: %v", err)
+	}
+}
+
+func TestDryRunCollectsNoGarbage(t *testing.T) {
+	ts := newTestSyncer(t, Options{DryRun: true},
+		newNamespace("demo", nil, nil),
+		newCopy("demo", "gone", "demo", "gone"),
+	)
+	log := ts.recordWrites()
+
+	ts.collectGarbage()
+	if len(log.writes) > 0 {
+		t.Errorf("writes = %v, want none in dry run", log.writes)
+	}
+	if want := []string{"delete configmaps demo/gone"}; !reflect.DeepEqual(log.dryRuns, want) {
+		t.Errorf("dry runs = %v, want %v", log.dryRuns, want)
+	}
+	if _, err := ts.dc.Resource(ConfigMaps.GroupVersionResource).Namespace("demo").Get(context.TODO(), "gone", metav1.GetOptions{}); err != nil {
+		t.Errorf("orphaned copy was deleted in dry run: %v", err)
+	}
+}
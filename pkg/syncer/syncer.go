@@ -17,129 +17,275 @@ limitations under the License.
 package syncer
 
 import (
-	"context"
-	"net/url"
+	"strings"
 	"sync"
+	"time"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/pkg/errors"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
-	clientcmd_util "kmodules.xyz/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/tools/queue"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
 const (
-	ConfigSyncKey      = "kubed.appscode.com/sync"
-	ConfigOriginKey    = "kubed.appscode.com/origin"
-	ConfigSyncContexts = "kubed.appscode.com/sync-contexts"
+	ConfigSyncKey        = "kubed.appscode.com/sync"
+	ConfigOriginKey      = "kubed.appscode.com/origin"
+	ConfigSyncContexts   = "kubed.appscode.com/sync-contexts"
+	ConfigIncludeKeys    = "kubed.appscode.com/sync-include-keys"
+	ConfigExcludeKeys    = "kubed.appscode.com/sync-exclude-keys"
+	ConfigRenameKeys     = "kubed.appscode.com/sync-rename-keys"
+	ConfigTargetName     = "kubed.appscode.com/sync-target-name"
+	ConfigTransform      = "kubed.appscode.com/sync-transform"
+	ConfigTemplate       = "kubed.appscode.com/sync-template"
+	ConfigConflictPolicy = "kubed.appscode.com/sync-conflict-policy"
+	ConfigRequestedBy    = "kubed.appscode.com/sync-requested-by"
+	// ConfigRequesterSignature signs the sync annotations stamped by the mutating admission webhook
+	ConfigRequesterSignature = "kubed.appscode.com/sync-requested-by-signature"
+	// RequesterKeySecretKey is the key of the Secret that holds the key signing the sync-requested-by annotation
+	RequesterKeySecretKey = "key"
 
 	OriginNameLabelKey      = "kubed.appscode.com/origin.name"
 	OriginNamespaceLabelKey = "kubed.appscode.com/origin.namespace"
 	OriginClusterLabelKey   = "kubed.appscode.com/origin.cluster"
+
+	// FieldManager is the field manager of the creates and patches of copies
+	FieldManager = "config-syncer"
 )
 
 type ConfigSyncer struct {
-	kubeClient kubernetes.Interface
-	recorder   record.EventRecorder
+	kubeClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+	recorder      record.EventRecorder
+
+	clusterName    string
+	kubeconfigFile string
+	fileContexts   map[string]clusterContext
+	secretContexts map[string]map[string]clusterContext // by cluster Secret key
+	contexts       map[string]clusterContext
+	// set once Run was called, sources are only enqueued for changed contexts while leading
+	leading bool
+	lock    sync.RWMutex
+
+	resources     []*resourceSyncer
+	nsQueue       *queue.Worker
+	nsIndexer     cache.Indexer
+	policyQueue   *queue.Worker
+	policyIndexer cache.Indexer
+
+	clusterQueue   *queue.Worker
+	clusterIndexer cache.Indexer
 
-	clusterName string
-	contexts    map[string]clusterContext
-	lock        sync.RWMutex
+	dryRun         bool
+	conflictPolicy api.ConflictPolicy
+	gcInterval     time.Duration
+	gcDryRun       bool
+	authorizeSyncs bool
+	authzCache     *utilcache.LRUExpireCache
+	requesterKey   []byte
+	// namespace selectors of the webhooks verifying the requester of syncs, by resource
+	requesterWebhooks map[schema.GroupVersionResource][]labels.Selector
+	policy            *OperatorPolicy
+
+	healthCheckInterval time.Duration
+	failureThreshold    int
+	health              map[string]*contextHealth
+	healthLock          sync.Mutex
 }
 
-func New(kc kubernetes.Interface, recorder record.EventRecorder) *ConfigSyncer {
-	return &ConfigSyncer{
-		kubeClient: kc,
-		recorder:   recorder,
+// Options configures a ConfigSyncer.
+type Options struct {
+	Resources      []Resource
+	MaxNumRequeues int
+	NumThreads     int
+	// If set, creates, patches and deletes are sent as server side dry runs and logged.
+	DryRun bool
+	// Default policy for existing objects in target namespaces that are not copies. Defaults to overwrite.
+	ConflictPolicy api.ConflictPolicy
+
+	// Period of the garbage collection of orphaned copies. Zero disables the garbage collection.
+	GCInterval time.Duration
+	// If set, orphaned copies are only reported.
+	GCDryRun bool
+	// If set, copies requested via annotations are only made into namespaces where the requester may create them.
+	AuthorizeSyncs bool
+	// Signs the sync-requested-by annotations stamped by the mutating admission webhook. Required with AuthorizeSyncs.
+	RequesterKey []byte
+	// Restricts the namespaces that take part in syncs. If nil, every namespace may be a source and a target.
+	Policy *OperatorPolicy
+
+	// Period of the health probes of remote contexts. Zero disables the probes.
+	HealthCheckInterval time.Duration
+	// Number of consecutive failed probes after which a context is skipped until it recovers.
+	FailureThreshold int
+}
+
+func New(kc kubernetes.Interface, dc dynamic.Interface, recorder record.EventRecorder, opts Options) *ConfigSyncer {
+	RegisterMetrics()
+
+	s := &ConfigSyncer{
+		kubeClient:          kc,
+		dynamicClient:       dc,
+		recorder:            recorder,
+		dryRun:              opts.DryRun,
+		conflictPolicy:      opts.ConflictPolicy,
+		gcInterval:          opts.GCInterval,
+		gcDryRun:            opts.GCDryRun,
+		authorizeSyncs:      opts.AuthorizeSyncs,
+		requesterKey:        opts.RequesterKey,
+		policy:              opts.Policy,
+		authzCache:          utilcache.NewLRUExpireCache(authzCacheSize),
+		secretContexts:      map[string]map[string]clusterContext{},
+		healthCheckInterval: opts.HealthCheckInterval,
+		failureThreshold:    opts.FailureThreshold,
+		health:              map[string]*contextHealth{},
+	}
+	if s.conflictPolicy == "" {
+		s.conflictPolicy = api.ConflictPolicyOverwrite
+	}
+	for _, r := range opts.Resources {
+		s.resources = append(s.resources, s.newResourceSyncer(r, opts.MaxNumRequeues, opts.NumThreads))
 	}
+	s.nsQueue = queue.New("Namespace", opts.MaxNumRequeues, opts.NumThreads, s.reconcileNamespace)
+	s.policyQueue = queue.New("SyncPolicy", opts.MaxNumRequeues, opts.NumThreads, s.reconcileSyncPolicy)
+	s.clusterQueue = queue.New("ClusterSecret", opts.MaxNumRequeues, opts.NumThreads, s.reconcileClusterSecret)
+	return s
 }
 
-func (s *ConfigSyncer) Configure(clusterName string, kubeconfigFile string) error {
-	s.lock.Lock()
-	defer s.lock.Unlock()
+func (s *ConfigSyncer) dryRunOpts() []string {
+	if s.dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
 
-	s.clusterName = clusterName
-	s.contexts = map[string]clusterContext{}
+// Resources returns the resources whose objects are synced.
+func (s *ConfigSyncer) Resources() []schema.GroupVersionResource {
+	out := make([]schema.GroupVersionResource, 0, len(s.resources))
+	for _, r := range s.resources {
+		out = append(out, r.GroupVersionResource)
+	}
+	return out
+}
 
-	// Parse external kubeconfig file, assume that it doesn't include source cluster
-	if kubeconfigFile != "" {
-		kConfig, err := clientcmd.LoadFromFile(kubeconfigFile)
-		if err != nil {
-			return errors.Errorf("failed to parse context list. Reason: %v", err)
+func (s *ConfigSyncer) resourceFor(gvr schema.GroupVersionResource) *resourceSyncer {
+	for _, r := range s.resources {
+		if r.GroupVersionResource == gvr {
+			return r
 		}
+	}
+	return nil
+}
 
-		for contextName := range kConfig.Contexts {
-			ctx := clusterContext{}
+func (s *ConfigSyncer) resourceForKind(gk schema.GroupKind) *resourceSyncer {
+	for _, r := range s.resources {
+		if r.Group == gk.Group && r.Kind == gk.Kind {
+			return r
+		}
+	}
+	return nil
+}
 
-			cfg, err := clientcmd_util.BuildConfigFromContext(kubeconfigFile, contextName)
-			if err != nil {
-				continue
-			}
-			if ctx.Client, err = kubernetes.NewForConfig(cfg); err != nil {
-				continue
-			}
-			if ctx.Namespace, err = clientcmd_util.NamespaceFromContext(kubeconfigFile, contextName); err != nil {
-				continue
-			}
+// Run starts the workers processing the resource, Namespace and SyncPolicy queues along with the health
+// probes of remote contexts. It should be called after the informer caches have synced. With leader
+// election, only the leader calls Run.
+func (s *ConfigSyncer) Run(stopCh <-chan struct{}) {
+	s.lock.Lock()
+	s.leading = true
+	s.lock.Unlock()
 
-			u, err := url.Parse(cfg.Host)
-			if err != nil {
-				continue
-			}
-			host := u.Hostname()
-			port := u.Port()
-			if port == "" {
-				if u.Scheme == "https" {
-					port = "443"
-				} else if u.Scheme == "http" {
-					port = "80"
-				}
-			}
-			ctx.Address = host + ":" + port
-			s.contexts[contextName] = ctx
+	if s.healthCheckInterval > 0 {
+		go wait.Until(s.probeContexts, s.healthCheckInterval, stopCh)
+	}
+	if s.gcInterval > 0 {
+		s.lock.RLock()
+		clusterName := s.clusterName
+		s.lock.RUnlock()
+		if clusterName == "" {
+			// copies made by other clusters that kept the default name could not be told apart from ours
+			klog.Warningln("garbage collection is disabled, it requires --cluster-name to be set")
+		} else {
+			go wait.Until(s.collectGarbage, s.gcInterval, stopCh)
 		}
 	}
-	return nil
+	for _, r := range s.resources {
+		r.queue.Run(stopCh)
+		r.copyQueue.Run(stopCh)
+	}
+	s.nsQueue.Run(stopCh)
+	s.policyQueue.Run(stopCh)
+}
+
+// RunClusterSecrets starts the workers loading contexts from cluster Secrets. Every replica runs them,
+// so that standby replicas know the same contexts as the leader when validating sources and serving the
+// ClusterContexts API. It should be called after the informer caches have synced.
+func (s *ConfigSyncer) RunClusterSecrets(stopCh <-chan struct{}) {
+	s.clusterQueue.Run(stopCh)
+}
+
+func (s *ConfigSyncer) Configure(clusterName string, kubeconfigFile string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.clusterName = clusterName
+	s.kubeconfigFile = kubeconfigFile
+
+	contexts, err := loadContexts(kubeconfigFile)
+	if err != nil {
+		contexts = map[string]clusterContext{}
+	}
+	s.fileContexts = contexts
+	s.rebuildContexts()
+	return err
 }
 
 type clusterContext struct {
 	Client    kubernetes.Interface
+	Dynamic   dynamic.Interface
 	Namespace string
 	Address   string
+	Cluster   string
+
+	// context, cluster and user entries of the kubeconfig file used to detect changes
+	config []interface{}
 }
 
 func (s *ConfigSyncer) SyncIntoNamespace(namespace string) error {
-	ns, err := s.kubeClient.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+	ns, err := s.getNamespace(namespace)
 	if err != nil {
 		return err
 	}
 
-	configMaps, err := s.kubeClient.CoreV1().ConfigMaps(core.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return err
-	}
-	for _, configMap := range configMaps.Items {
-		if err = s.syncConfigMapIntoNewNamespace(&configMap, ns); err != nil {
-			return err
+	// a misconfigured source must not keep the other sources out of the namespace
+	var errs []error
+	for _, r := range s.resources {
+		sources, err := s.namespaceSyncSources(r)
+		if err != nil {
+			errs = append(errs, err)
+			continue
 		}
-	}
-
-	secrets, err := s.kubeClient.CoreV1().Secrets(core.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return err
-	}
-	for _, secret := range secrets.Items {
-		if err = s.syncSecretIntoNewNamespace(&secret, ns); err != nil {
-			return err
+		for _, src := range sources {
+			if _, err = s.syncIntoNamespace(r, src.DeepCopy(), ns); err != nil {
+				errs = append(errs, errors.Wrapf(err, "failed to sync %s %s/%s", strings.ToLower(r.Kind), src.GetNamespace(), src.GetName()))
+			}
 		}
 	}
-	return nil
+	return utilerrors.NewAggregate(errs)
 }
 
 func (s *ConfigSyncer) syncerLabels(name, namespace, cluster string) labels.Set {
@@ -150,10 +296,32 @@ func (s *ConfigSyncer) syncerLabels(name, namespace, cluster string) labels.Set
 	}
 }
 
+// isCopy returns true if obj is a copy. Copies carry the labels and sync annotations of their source,
+// so they must never be taken for sources themselves.
+func isCopy(obj metav1.Object) bool {
+	_, ok := obj.GetLabels()[OriginNameLabelKey]
+	return ok
+}
+
 func (s *ConfigSyncer) syncerLabelSelector(name, namespace, cluster string) string {
 	return labels.SelectorFromSet(s.syncerLabels(name, namespace, cluster)).String()
 }
 
+// syncAnnotationKeys are the annotations of a source that control syncing and are not copied.
+var syncAnnotationKeys = sets.NewString(
+	ConfigSyncKey,
+	ConfigSyncContexts,
+	ConfigIncludeKeys,
+	ConfigExcludeKeys,
+	ConfigRenameKeys,
+	ConfigTargetName,
+	ConfigTransform,
+	ConfigTemplate,
+	ConfigConflictPolicy,
+	ConfigRequestedBy,
+	ConfigRequesterSignature,
+)
+
 func (s *ConfigSyncer) syncerAnnotations(oldAnnotations, srcAnnotations map[string]string, srcRef core.ObjectReference) map[string]string {
 	newAnnotations := map[string]string{}
 
@@ -166,7 +334,7 @@ func (s *ConfigSyncer) syncerAnnotations(oldAnnotations, srcAnnotations map[stri
 	}
 
 	for k, v := range srcAnnotations {
-		if k != ConfigSyncKey && k != ConfigSyncContexts {
+		if !syncAnnotationKeys.Has(k) {
 			newAnnotations[k] = v
 		}
 	}
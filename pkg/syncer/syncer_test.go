@@ -0,0 +1,318 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+const testClusterName = "source"
+
+// testSyncer is a ConfigSyncer backed by fake clients. Its caches hold the objects it was created with,
+// while the fake clients hold every object written since.
+type testSyncer struct {
+	*ConfigSyncer
+	kc       *fake.Clientset
+	dc       *dynamicfake.FakeDynamicClient
+	recorder *record.FakeRecorder
+}
+
+func newTestSyncer(t *testing.T, opts Options, objs ...runtime.Object) *testSyncer {
+	t.Helper()
+	if len(opts.Resources) == 0 {
+		opts.Resources = DefaultResources()
+	}
+	var typed []runtime.Object
+	for _, obj := range objs {
+		if _, ok := obj.(*unstructured.Unstructured); !ok {
+			typed = append(typed, obj)
+		}
+	}
+	ts := &testSyncer{
+		kc:       fake.NewSimpleClientset(typed...),
+		dc:       dynamicfake.NewSimpleDynamicClient(scheme.Scheme, objs...),
+		recorder: record.NewFakeRecorder(1000),
+	}
+	ts.ConfigSyncer = New(ts.kc, ts.dc, ts.recorder, opts)
+	ts.nsIndexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ts.policyIndexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ts.clusterIndexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, r := range ts.resources {
+		r.indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			SyncAnnotationIndex:  syncAnnotationIndexFunc,
+			TransformIndex:       transformIndexFunc,
+		})
+	}
+	for _, obj := range objs {
+		ts.cache(t, obj)
+	}
+	if err := ts.Configure(testClusterName, ""); err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+// cache adds obj to the informer cache it would be found in.
+func (ts *testSyncer) cache(t *testing.T, obj runtime.Object) {
+	t.Helper()
+	var err error
+	switch o := obj.(type) {
+	case *core.Namespace:
+		err = ts.nsIndexer.Add(o)
+	default:
+		u := toUnstructured(t, obj)
+		if u.GroupVersionKind().GroupKind() == api.SchemeGroupVersion.WithKind(api.ResourceKindSyncPolicy).GroupKind() {
+			err = ts.policyIndexer.Add(u)
+		} else if r := ts.resourceForKind(u.GroupVersionKind().GroupKind()); r != nil {
+			err = r.indexer.Add(u)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// events returns the events recorded so far.
+func (ts *testSyncer) events() []string {
+	var out []string
+	for {
+		select {
+		case e := <-ts.recorder.Events:
+			out = append(out, e)
+		default:
+			return out
+		}
+	}
+}
+
+func toUnstructured(t *testing.T, obj runtime.Object) *unstructured.Unstructured {
+	t.Helper()
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.DeepCopy()
+	}
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Empty() {
+		gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gvk = gvks[0]
+	}
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &unstructured.Unstructured{Object: data}
+	u.SetGroupVersionKind(gvk)
+	return u
+}
+
+func newNamespace(name string, labels, annotations map[string]string) *core.Namespace {
+	return &core.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+	}
+}
+
+func newConfigMap(namespace, name string, annotations map[string]string) *core.ConfigMap {
+	return &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			UID:         types.UID("uid-" + namespace + "-" + name),
+			Annotations: annotations,
+		},
+		Data: map[string]string{
+			"you":  "only",
+			"live": "once",
+		},
+	}
+}
+
+// newCopy returns a copy of the source src/name made from the test cluster into namespace.
+func newCopy(namespace, name, srcNamespace, srcName string) *core.ConfigMap {
+	cm := newConfigMap(namespace, name, nil)
+	cm.Labels = map[string]string{
+		OriginNameLabelKey:      srcName,
+		OriginNamespaceLabelKey: srcNamespace,
+		OriginClusterLabelKey:   testClusterName,
+	}
+	return cm
+}
+
+// writeLog records the writes sent through the clients returned by recordWrites.
+// The fake clients ignore the dry run option, so dry run writes are recorded and dropped.
+type writeLog struct {
+	lock    sync.Mutex
+	writes  []string
+	dryRuns []string
+}
+
+// record logs a write and returns true if it is a dry run.
+func (w *writeLog) record(verb, resource, namespace, name string, dryRun []string) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	entry := verb + " " + resource + " " + namespace + "/" + name
+	if len(dryRun) == 1 && dryRun[0] == metav1.DryRunAll {
+		w.dryRuns = append(w.dryRuns, entry)
+		return true
+	}
+	w.writes = append(w.writes, entry)
+	return false
+}
+
+// recordWrites routes the writes of the syncer through a writeLog.
+func (ts *testSyncer) recordWrites() *writeLog {
+	log := &writeLog{}
+	ts.kubeClient = recordingKube{Interface: ts.kc, log: log}
+	ts.dynamicClient = recordingDynamic{Interface: ts.dc, log: log}
+	return log
+}
+
+type recordingDynamic struct {
+	dynamic.Interface
+	log *writeLog
+}
+
+func (d recordingDynamic) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	ri := d.Interface.Resource(gvr)
+	return recordingResource{ResourceInterface: ri, namespaceable: ri, resource: gvr.Resource, log: d.log}
+}
+
+type recordingResource struct {
+	dynamic.ResourceInterface
+	namespaceable dynamic.NamespaceableResourceInterface
+	resource      string
+	namespace     string
+	log           *writeLog
+}
+
+func (r recordingResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return recordingResource{ResourceInterface: r.namespaceable.Namespace(namespace), resource: r.resource, namespace: namespace, log: r.log}
+}
+
+func (r recordingResource) Create(ctx context.Context, obj *unstructured.Unstructured, opts metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if r.log.record("create", r.resource, r.namespace, obj.GetName(), opts.DryRun) {
+		return obj.DeepCopy(), nil
+	}
+	return r.ResourceInterface.Create(ctx, obj, opts, subresources...)
+}
+
+func (r recordingResource) Update(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if r.log.record("update", r.resource, r.namespace, obj.GetName(), opts.DryRun) {
+		return obj.DeepCopy(), nil
+	}
+	return r.ResourceInterface.Update(ctx, obj, opts, subresources...)
+}
+
+func (r recordingResource) UpdateStatus(ctx context.Context, obj *unstructured.Unstructured, opts metav1.UpdateOptions) (*unstructured.Unstructured, error) {
+	if r.log.record("update", r.resource+"/status", r.namespace, obj.GetName(), opts.DryRun) {
+		return obj.DeepCopy(), nil
+	}
+	return r.ResourceInterface.UpdateStatus(ctx, obj, opts)
+}
+
+func (r recordingResource) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	if r.log.record("patch", r.resource, r.namespace, name, opts.DryRun) {
+		return r.ResourceInterface.Get(ctx, name, metav1.GetOptions{})
+	}
+	return r.ResourceInterface.Patch(ctx, name, pt, data, opts, subresources...)
+}
+
+func (r recordingResource) Delete(ctx context.Context, name string, opts metav1.DeleteOptions, subresources ...string) error {
+	if r.log.record("delete", r.resource, r.namespace, name, opts.DryRun) {
+		_, err := r.ResourceInterface.Get(ctx, name, metav1.GetOptions{})
+		return err
+	}
+	return r.ResourceInterface.Delete(ctx, name, opts, subresources...)
+}
+
+type recordingKube struct {
+	kubernetes.Interface
+	log *writeLog
+}
+
+func (k recordingKube) CoreV1() corev1.CoreV1Interface {
+	return recordingCoreV1{CoreV1Interface: k.Interface.CoreV1(), log: k.log}
+}
+
+type recordingCoreV1 struct {
+	corev1.CoreV1Interface
+	log *writeLog
+}
+
+func (c recordingCoreV1) ConfigMaps(namespace string) corev1.ConfigMapInterface {
+	return recordingConfigMaps{ConfigMapInterface: c.CoreV1Interface.ConfigMaps(namespace), namespace: namespace, log: c.log}
+}
+
+type recordingConfigMaps struct {
+	corev1.ConfigMapInterface
+	namespace string
+	log       *writeLog
+}
+
+func (c recordingConfigMaps) Create(ctx context.Context, cm *core.ConfigMap, opts metav1.CreateOptions) (*core.ConfigMap, error) {
+	if c.log.record("create", "configmaps", c.namespace, cm.Name, opts.DryRun) {
+		return cm.DeepCopy(), nil
+	}
+	return c.ConfigMapInterface.Create(ctx, cm, opts)
+}
+
+func (c recordingConfigMaps) Update(ctx context.Context, cm *core.ConfigMap, opts metav1.UpdateOptions) (*core.ConfigMap, error) {
+	if c.log.record("update", "configmaps", c.namespace, cm.Name, opts.DryRun) {
+		return cm.DeepCopy(), nil
+	}
+	return c.ConfigMapInterface.Update(ctx, cm, opts)
+}
+
+func (c recordingConfigMaps) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*core.ConfigMap, error) {
+	if c.log.record("patch", "configmaps", c.namespace, name, opts.DryRun) {
+		return c.ConfigMapInterface.Get(ctx, name, metav1.GetOptions{})
+	}
+	return c.ConfigMapInterface.Patch(ctx, name, pt, data, opts, subresources...)
+}
+
+func (c recordingConfigMaps) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	if c.log.record("delete", "configmaps", c.namespace, name, opts.DryRun) {
+		_, err := c.ConfigMapInterface.Get(ctx, name, metav1.GetOptions{})
+		return err
+	}
+	return c.ConfigMapInterface.Delete(ctx, name, opts)
+}
@@ -0,0 +1,311 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	kmapi "kmodules.xyz/client-go/api/v1"
+	"kmodules.xyz/client-go/conditions"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+const (
+	SyncPolicyReasonInvalid = "InvalidPolicy"
+)
+
+func (s *ConfigSyncer) SetupSyncPolicyInformer(informer cache.SharedIndexInformer) {
+	s.policyIndexer = informer.GetIndexer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			s.enqueueSyncPolicy(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldRes, ok := oldObj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			newRes, ok := newObj.(*unstructured.Unstructured)
+			if !ok {
+				return
+			}
+			// ignore status updates
+			if oldRes.GetGeneration() != newRes.GetGeneration() {
+				s.enqueueSyncPolicy(oldObj)
+				s.enqueueSyncPolicy(newObj)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			s.enqueueSyncPolicy(obj)
+		},
+	})
+}
+
+// enqueueSyncPolicy enqueues the policy itself and every source it selects, so that
+// the copies are reconciled against the changed policy.
+func (s *ConfigSyncer) enqueueSyncPolicy(obj interface{}) {
+	policy, err := toSyncPolicy(obj)
+	if err != nil {
+		klog.Errorln(err)
+		return
+	}
+	queue.Enqueue(s.policyQueue.GetQueue(), policy)
+
+	sources, err := s.sourcesForSyncPolicy(policy)
+	if err != nil {
+		klog.Errorf("failed to list sources for syncpolicy %s: %v", policy.Name, err)
+		return
+	}
+	r := s.resourceForKind(schema.GroupKind{Kind: string(policy.Spec.Source.Kind)})
+	for _, src := range sources {
+		queue.Enqueue(r.queue.GetQueue(), src)
+	}
+}
+
+// enqueueSyncPoliciesFor enqueues the policies that may select a source of the given kind in namespace,
+// so that their status reflects the current set of sources.
+func (s *ConfigSyncer) enqueueSyncPoliciesFor(kind api.SourceKind, namespace string) {
+	for _, obj := range s.policyIndexer.List() {
+		policy, err := toSyncPolicy(obj)
+		if err != nil {
+			klog.Errorln(err)
+			continue
+		}
+		if policy.Spec.Source.Kind == kind && policy.Spec.Source.Namespace == namespace {
+			queue.Enqueue(s.policyQueue.GetQueue(), policy)
+		}
+	}
+}
+
+// syncPoliciesFor returns the policies that select obj as a source.
+func (s *ConfigSyncer) syncPoliciesFor(kind api.SourceKind, obj metav1.Object) []*api.SyncPolicy {
+	var policies []*api.SyncPolicy
+	for _, item := range s.policyIndexer.List() {
+		policy, err := toSyncPolicy(item)
+		if err != nil {
+			klog.Errorln(err)
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	return SelectSyncPolicies(policies, kind, obj)
+}
+
+// SelectSyncPolicies returns the policies that select obj, a source of the given kind, sorted by name.
+// Sync status ConfigMaps and copies are never selected.
+func SelectSyncPolicies(policies []*api.SyncPolicy, kind api.SourceKind, obj metav1.Object) []*api.SyncPolicy {
+	if kind == "" || isSyncStatus(obj) || isCopy(obj) {
+		return nil
+	}
+	var out []*api.SyncPolicy
+	for _, policy := range policies {
+		if ok, err := policy.Selects(kind, obj); err != nil {
+			klog.Errorf("invalid source selector in syncpolicy %s: %v", policy.Name, err)
+		} else if ok {
+			out = append(out, policy)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// syncOptionsFor merges the sync annotations of obj with the policies that select it.
+func (s *ConfigSyncer) syncOptionsFor(kind api.SourceKind, obj metav1.Object) SyncOptions {
+	return MergeSyncOptions(obj, s.syncPoliciesFor(kind, obj))
+}
+
+// MergeSyncOptions merges the sync annotations of obj with the policies that select it.
+// The target name, key renames, transform and conflict policy of the annotations take precedence over those of the policies,
+// which are applied in the given order.
+func MergeSyncOptions(obj metav1.Object, policies []*api.SyncPolicy) SyncOptions {
+	opts := GetSyncOptions(obj.GetAnnotations())
+	for _, policy := range policies {
+		selectors, err := policy.NamespaceSelectors()
+		if err != nil {
+			klog.Errorf("invalid namespace selector in syncpolicy %s: %v", policy.Name, err)
+			continue
+		}
+		opts.NamespaceSelectors = append(opts.NamespaceSelectors, selectors...)
+		opts.Contexts = opts.Contexts.Union(sets.NewString(policy.Spec.Target.Contexts...))
+		opts.Keys.Include = append(opts.Keys.Include, policy.Spec.Keys.Include...)
+		opts.Keys.Exclude = append(opts.Keys.Exclude, policy.Spec.Keys.Exclude...)
+		for from, to := range policy.Spec.Keys.Rename {
+			if _, ok := opts.Keys.Rename[from]; !ok {
+				if opts.Keys.Rename == nil {
+					opts.Keys.Rename = map[string]string{}
+				}
+				opts.Keys.Rename[from] = to
+			}
+		}
+		if opts.TargetName == "" {
+			opts.TargetName = policy.Spec.Target.Name
+		}
+		if opts.Transform == nil {
+			opts.Transform = policy.Spec.Transform
+		}
+		opts.Template = opts.Template || policy.Spec.Template
+		if opts.ConflictPolicy == "" {
+			opts.ConflictPolicy = policy.Spec.Target.ConflictPolicy
+		}
+	}
+	return opts
+}
+
+func (s *ConfigSyncer) sourcesForSyncPolicy(policy *api.SyncPolicy) ([]metav1.Object, error) {
+	r := s.resourceForKind(schema.GroupKind{Kind: string(policy.Spec.Source.Kind)})
+	if r == nil {
+		return nil, errors.Errorf("unknown source kind %q", policy.Spec.Source.Kind)
+	}
+
+	objs, err := r.indexer.ByIndex(cache.NamespaceIndex, policy.Spec.Source.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var out []metav1.Object
+	for _, obj := range objs {
+		o := obj.(metav1.Object)
+		if isSyncStatus(o) || isCopy(o) {
+			// copies land in the source namespace when they are renamed, and keep the labels of their source
+			continue
+		}
+		if ok, err := policy.Selects(policy.Spec.Source.Kind, o); err != nil {
+			return nil, err
+		} else if ok {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (s *ConfigSyncer) reconcileSyncPolicy(key string) error {
+	obj, exists, err := s.policyIndexer.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		klog.V(4).Infof("syncpolicy %s does not exist anymore", key)
+		return nil
+	}
+	policy, err := toSyncPolicy(obj)
+	if err != nil {
+		return err
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	in := policy.DeepCopy()
+	policy.Status.ObservedGeneration = policy.Generation
+	policy.Status.Sources = nil
+
+	if err := s.validateSyncPolicy(policy); err != nil {
+		conditions.MarkFalse(policy, kmapi.ReadyCondition, SyncPolicyReasonInvalid, kmapi.ConditionSeverityError, err.Error())
+	} else {
+		sources, err := s.sourcesForSyncPolicy(policy)
+		if err != nil {
+			return err
+		}
+		for _, src := range sources {
+			policy.Status.Sources = append(policy.Status.Sources, kmapi.ObjectReference{
+				Namespace: src.GetNamespace(),
+				Name:      src.GetName(),
+			})
+		}
+		conditions.MarkTrue(policy, kmapi.ReadyCondition)
+	}
+
+	if equality.Semantic.DeepEqual(in.Status, policy.Status) {
+		return nil
+	}
+	return s.updateSyncPolicyStatus(policy)
+}
+
+func (s *ConfigSyncer) validateSyncPolicy(policy *api.SyncPolicy) error {
+	src := policy.Spec.Source
+	if src.Name == "" && src.Selector == nil {
+		return errors.New("one of source name or selector must be set")
+	}
+	if src.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(src.Selector); err != nil {
+			return errors.Wrap(err, "invalid source selector")
+		}
+	}
+	if _, err := policy.NamespaceSelectors(); err != nil {
+		return errors.Wrap(err, "invalid namespace selector")
+	}
+	if err := ValidateKeyFilter(policy.Spec.Keys); err != nil {
+		return err
+	}
+	if name := policy.Spec.Target.Name; name != "" {
+		if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+			return errors.Errorf("invalid target name %q: %s", name, strings.Join(msgs, ", "))
+		}
+	}
+	taken := map[string]string{}
+	for _, ctx := range policy.Spec.Target.Contexts {
+		context, found := s.contexts[ctx]
+		if !found {
+			return errors.Errorf("context %s not found in kubeconfig file", ctx)
+		}
+		if other, found := taken[context.Address]; found {
+			return errors.Errorf("contexts %s and %s point to the same cluster", other, ctx)
+		}
+		taken[context.Address] = ctx
+	}
+	return nil
+}
+
+func (s *ConfigSyncer) updateSyncPolicyStatus(policy *api.SyncPolicy) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(policy)
+	if err != nil {
+		return err
+	}
+	_, err = s.dynamicClient.
+		Resource(api.SchemeGroupVersion.WithResource(api.ResourceSyncPolicies)).
+		UpdateStatus(context.TODO(), &unstructured.Unstructured{Object: content}, metav1.UpdateOptions{DryRun: s.dryRunOpts()})
+	return err
+}
+
+func toSyncPolicy(obj interface{}) (*api.SyncPolicy, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("expected *unstructured.Unstructured, found %T", obj)
+	}
+	var policy api.SyncPolicy
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
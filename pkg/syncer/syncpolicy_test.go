@@ -0,0 +1,156 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newSyncPolicy(name string, source api.SyncSource, target api.SyncTarget) *api.SyncPolicy {
+	return &api.SyncPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: api.SchemeGroupVersion.String(),
+			Kind:       api.ResourceKindSyncPolicy,
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: api.SyncPolicySpec{
+			Source: source,
+			Target: target,
+		},
+	}
+}
+
+func TestSelectSyncPolicies(t *testing.T) {
+	byName := newSyncPolicy("by-name", api.SyncSource{Kind: api.SourceKindConfigMap, Namespace: "demo", Name: "omni"}, api.SyncTarget{})
+	bySelector := newSyncPolicy("by-selector", api.SyncSource{
+		Kind:      api.SourceKindConfigMap,
+		Namespace: "demo",
+		Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"app": "a"}},
+	}, api.SyncTarget{})
+	policies := []*api.SyncPolicy{bySelector, byName}
+
+	source := newConfigMap("demo", "omni", nil)
+	source.Labels = map[string]string{"app": "a"}
+	copied := source.DeepCopy()
+	copied.Name = "omni-copy"
+	copied.Labels[OriginNameLabelKey] = "omni"
+	status := source.DeepCopy()
+	status.Name = syncStatusName("ConfigMap", "omni")
+	status.Labels[StatusKindLabelKey] = "ConfigMap"
+	other := source.DeepCopy()
+	other.Namespace = "team"
+
+	cases := []struct {
+		name string
+		kind api.SourceKind
+		obj  metav1.Object
+		want []string
+	}{
+		{name: "name and selector", kind: api.SourceKindConfigMap, obj: source, want: []string{"by-name", "by-selector"}},
+		{name: "other kind", kind: api.SourceKindSecret, obj: source, want: nil},
+		{name: "no kind", kind: "", obj: source, want: nil},
+		{name: "other namespace", kind: api.SourceKindConfigMap, obj: other, want: nil},
+		{name: "copy", kind: api.SourceKindConfigMap, obj: copied, want: nil},
+		{name: "sync status", kind: api.SourceKindConfigMap, obj: status, want: nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			for _, p := range SelectSyncPolicies(policies, c.kind, c.obj) {
+				got = append(got, p.Name)
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("SelectSyncPolicies() = %v, want %v", got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Errorf("SelectSyncPolicies() = %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSourcesForSyncPolicySkipsCopies(t *testing.T) {
+	source := newConfigMap("demo", "omni", nil)
+	source.Labels = map[string]string{"app": "a"}
+	// a copy renamed into the source namespace keeps the labels of its source
+	copied := source.DeepCopy()
+	copied.Name = "omni-copy"
+	copied.Labels[OriginNameLabelKey] = "omni"
+	copied.Labels[OriginNamespaceLabelKey] = "demo"
+	copied.Labels[OriginClusterLabelKey] = testClusterName
+	policy := newSyncPolicy("by-selector", api.SyncSource{
+		Kind:      api.SourceKindConfigMap,
+		Namespace: "demo",
+		Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"app": "a"}},
+	}, api.SyncTarget{Name: "omni-copy", NamespaceSelectors: []metav1.LabelSelector{{}}})
+
+	ts := newTestSyncer(t, Options{}, newNamespace("demo", nil, nil), source, copied, toUnstructured(t, policy))
+	sources, err := ts.sourcesForSyncPolicy(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || sources[0].GetName() != "omni" {
+		var names []string
+		for _, src := range sources {
+			names = append(names, src.GetName())
+		}
+		t.Errorf("sourcesForSyncPolicy() = %v, want [omni]", names)
+	}
+	if opts := ts.syncOptionsFor(api.SourceKindConfigMap, toUnstructured(t, copied)); len(opts.NamespaceSelectors) > 0 {
+		t.Errorf("copy is synced into %v", opts.NamespaceSelectors)
+	}
+}
+
+func TestMergeSyncOptions(t *testing.T) {
+	policy := newSyncPolicy("p", api.SyncSource{Kind: api.SourceKindConfigMap, Namespace: "demo", Name: "omni"}, api.SyncTarget{
+		Name:               "from-policy",
+		NamespaceSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"app": "a"}}},
+		Contexts:           []string{"remote"},
+		ConflictPolicy:     api.ConflictPolicySkip,
+	})
+	policy.Spec.Keys = api.KeyFilter{Include: []string{"*.yaml"}, Rename: map[string]string{"a": "b", "c": "d"}}
+
+	src := newConfigMap("demo", "omni", map[string]string{
+		ConfigSyncKey:        "app=b",
+		ConfigTargetName:     "from-annotation",
+		ConfigRenameKeys:     "a=x",
+		ConfigConflictPolicy: string(api.ConflictPolicyOverwrite),
+	})
+	opts := MergeSyncOptions(src, []*api.SyncPolicy{policy})
+
+	if want := []string{"app=b", "app=a"}; len(opts.NamespaceSelectors) != 2 || opts.NamespaceSelectors[0] != want[0] || opts.NamespaceSelectors[1] != want[1] {
+		t.Errorf("NamespaceSelectors = %v, want %v", opts.NamespaceSelectors, want)
+	}
+	if !opts.Contexts.Has("remote") {
+		t.Errorf("Contexts = %v, want remote", opts.Contexts.List())
+	}
+	if opts.TargetName != "from-annotation" {
+		t.Errorf("TargetName = %q, want the annotation to take precedence", opts.TargetName)
+	}
+	if opts.Keys.Rename["a"] != "x" || opts.Keys.Rename["c"] != "d" {
+		t.Errorf("Rename = %v, want a=x from the annotation and c=d from the policy", opts.Keys.Rename)
+	}
+	if opts.ConflictPolicy != api.ConflictPolicyOverwrite {
+		t.Errorf("ConflictPolicy = %q, want the annotation to take precedence", opts.ConflictPolicy)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TemplateData is passed to the templates of a ConfigMap when it is synced into a target namespace.
+type TemplateData struct {
+	Namespace TemplateNamespace
+	// Cluster is the name of the target cluster
+	Cluster string
+	// Context is the name of the target context, empty for the source cluster
+	Context string
+}
+
+type TemplateNamespace struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+func (s *ConfigSyncer) templateData(ns *core.Namespace, ctx string) TemplateData {
+	cluster := s.clusterName
+	if ctx != "" {
+		cluster = s.contexts[ctx].Cluster
+	}
+	return TemplateData{
+		Namespace: TemplateNamespace{
+			Name:        ns.Name,
+			Labels:      ns.Labels,
+			Annotations: ns.Annotations,
+		},
+		Cluster: cluster,
+		Context: ctx,
+	}
+}
+
+// renderTemplates returns a copy of src whose data values are rendered as Go templates.
+func renderTemplates(src *unstructured.Unstructured, data TemplateData) (*unstructured.Unstructured, error) {
+	values, found, err := unstructured.NestedStringMap(src.Object, "data")
+	if err != nil || !found {
+		return src, err
+	}
+
+	var buf bytes.Buffer
+	for k, v := range values {
+		t, err := template.New(k).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid template in key %s", k)
+		}
+		buf.Reset()
+		if err := t.Execute(&buf, data); err != nil {
+			return nil, errors.Wrapf(err, "failed to render key %s", k)
+		}
+		values[k] = buf.String()
+	}
+
+	dst := src.DeepCopy()
+	if err := unstructured.SetNestedStringMap(dst.Object, values, "data"); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	data := TemplateData{
+		Namespace: TemplateNamespace{
+			Name:   "team",
+			Labels: map[string]string{"tier": "web"},
+		},
+		Cluster: "prod",
+		Context: "remote",
+	}
+	cases := []struct {
+		name    string
+		data    map[string]interface{}
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "fields",
+			data: map[string]interface{}{
+				"url":  "https://{{ .Namespace.Name }}.{{ .Cluster }}.example.com",
+				"tier": `{{ index .Namespace.Labels "tier" }}`,
+				"ctx":  "{{ .Context }}",
+				"raw":  "plain",
+			},
+			want: map[string]interface{}{
+				"url":  "https://team.prod.example.com",
+				"tier": "web",
+				"ctx":  "remote",
+				"raw":  "plain",
+			},
+		},
+		{
+			name:    "missing label",
+			data:    map[string]interface{}{"tier": "{{ .Namespace.Labels.zone }}"},
+			wantErr: `failed to render key tier`,
+		},
+		{
+			// index is the way to look up optional labels and annotations
+			name: "missing annotation using index",
+			data: map[string]interface{}{"owner": `{{ index .Namespace.Annotations "owner" }}`},
+			want: map[string]interface{}{"owner": ""},
+		},
+		{
+			name:    "unknown field",
+			data:    map[string]interface{}{"region": "{{ .Region }}"},
+			wantErr: "failed to render key region",
+		},
+		{
+			name:    "invalid template",
+			data:    map[string]interface{}{"broken": "{{ .Namespace.Name "},
+			wantErr: "invalid template in key broken",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			src := &unstructured.Unstructured{Object: map[string]interface{}{"data": c.data}}
+			before := src.DeepCopy()
+			out, err := renderTemplates(src, data)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("renderTemplates() = %v, want %q", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.want != nil && !reflect.DeepEqual(out.Object["data"], c.want) {
+				t.Errorf("data = %v, want %v", out.Object["data"], c.want)
+			}
+			if !reflect.DeepEqual(src, before) {
+				t.Errorf("renderTemplates() modified the source")
+			}
+		})
+	}
+}
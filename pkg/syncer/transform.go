@@ -0,0 +1,296 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	"github.com/pkg/errors"
+	"go.starlark.net/starlark"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+const (
+	// DefaultTransformKey is the key of the script in the ConfigMap referenced by a transform
+	DefaultTransformKey = "transform.star"
+	// TransformMaxSteps limits the number of steps a transform script may execute per call
+	TransformMaxSteps = 1000000
+
+	transformFunc = "transform"
+)
+
+// transform is a compiled Starlark script that customises the copies of a source per target.
+//
+// The script must define a function
+//
+//	def transform(data, namespace, labels, context)
+//
+// that receives the data of the source, the target namespace, the labels of the target
+// namespace and the name of the target context, and returns a dict with optional
+// "data", "labels" and "annotations" entries. Returned data replaces the data of the
+// copy, returned labels and annotations are added to those of the copy.
+type transform struct {
+	ref api.TransformRef
+	fn  starlark.Callable
+}
+
+// parseTransformRef parses a reference in the form <configmap> or <configmap>/<key>.
+func parseTransformRef(v string) (*api.TransformRef, error) {
+	name, key, _ := strings.Cut(v, "/")
+	if name == "" {
+		return nil, errors.Errorf("invalid transform %q, expected <configmap> or <configmap>/<key>", v)
+	}
+	return &api.TransformRef{Name: name, Key: key}, nil
+}
+
+func transformIndexKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func transformIndexFunc(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := m.GetAnnotations()[ConfigTransform]
+	if !ok {
+		return nil, nil
+	}
+	ref, err := parseTransformRef(v)
+	if err != nil {
+		return nil, nil
+	}
+	return []string{transformIndexKey(m.GetNamespace(), ref.Name)}, nil
+}
+
+// enqueueTransformUsers enqueues the sources whose transform script is held in the ConfigMap namespace/name.
+func (s *ConfigSyncer) enqueueTransformUsers(namespace, name string) {
+	for _, r := range s.resources {
+		objs, err := r.indexer.ByIndex(TransformIndex, transformIndexKey(namespace, name))
+		if err != nil {
+			klog.Errorln(err)
+			continue
+		}
+		for _, obj := range objs {
+			queue.Enqueue(r.queue.GetQueue(), obj)
+		}
+	}
+
+	for _, item := range s.policyIndexer.List() {
+		policy, err := toSyncPolicy(item)
+		if err != nil {
+			klog.Errorln(err)
+			continue
+		}
+		if policy.Spec.Transform == nil || policy.Spec.Transform.Name != name || policy.Spec.Source.Namespace != namespace {
+			continue
+		}
+		sources, err := s.sourcesForSyncPolicy(policy)
+		if err != nil {
+			klog.Errorf("failed to list sources for syncpolicy %s: %v", policy.Name, err)
+			continue
+		}
+		r := s.resourceForKind(schema.GroupKind{Kind: string(policy.Spec.Source.Kind)})
+		for _, src := range sources {
+			queue.Enqueue(r.queue.GetQueue(), src)
+		}
+	}
+}
+
+// loadTransform compiles the script referenced by ref in the namespace of the source.
+func (s *ConfigSyncer) loadTransform(r *resourceSyncer, namespace string, ref *api.TransformRef) (*transform, error) {
+	if _, ok := r.dataField(); !ok {
+		return nil, errors.Errorf("transforms are not supported for %s", r.Kind)
+	}
+	key := ref.Key
+	if key == "" {
+		key = DefaultTransformKey
+	}
+	obj, exists, err := s.resourceFor(ConfigMaps.GroupVersionResource).indexer.GetByKey(namespace + "/" + ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.Errorf("transform configmap %s/%s not found", namespace, ref.Name)
+	}
+	script, found, err := unstructured.NestedString(obj.(*unstructured.Unstructured).Object, "data", key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.Errorf("transform configmap %s/%s has no key %s", namespace, ref.Name, key)
+	}
+
+	thread := newTransformThread(ref.Name)
+	globals, err := starlark.ExecFile(thread, ref.Name+"/"+key, script, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load transform %s/%s", namespace, ref.Name)
+	}
+	fn, ok := globals[transformFunc].(starlark.Callable)
+	if !ok {
+		return nil, errors.Errorf("transform %s/%s does not define function %s", namespace, ref.Name, transformFunc)
+	}
+	return &transform{ref: *ref, fn: fn}, nil
+}
+
+// newTransformThread returns a thread that can not load modules and is limited to TransformMaxSteps.
+func newTransformThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: "transform " + name,
+		Load: func(_ *starlark.Thread, module string) (starlark.StringDict, error) {
+			return nil, errors.Errorf("load of %s is not allowed", module)
+		},
+		Print: func(_ *starlark.Thread, msg string) {
+			klog.V(4).Infof("transform %s: %s", name, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(TransformMaxSteps)
+	return thread
+}
+
+// dataField returns the field holding the data of the resource and whether its values are base64 encoded.
+func (r *resourceSyncer) dataField() (encoded bool, ok bool) {
+	for _, f := range r.Strategy.KeyFields {
+		if f == "data" {
+			return r.Group == "" && r.Kind == "Secret", true
+		}
+	}
+	return false, false
+}
+
+// apply returns a copy of src customised for the target namespace in ctx.
+func (t *transform) apply(r *resourceSyncer, src *unstructured.Unstructured, namespace string, nsLabels map[string]string, ctx string) (*unstructured.Unstructured, error) {
+	encoded, _ := r.dataField()
+	data, _, err := unstructured.NestedStringMap(src.Object, "data")
+	if err != nil {
+		return nil, err
+	}
+	in := starlark.NewDict(len(data))
+	for k, v := range data {
+		if encoded {
+			b, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return nil, err
+			}
+			v = string(b)
+		}
+		if err := in.SetKey(starlark.String(k), starlark.String(v)); err != nil {
+			return nil, err
+		}
+	}
+	nsLbls, err := toStarlarkDict(nsLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := newTransformThread(t.ref.Name)
+	result, err := starlark.Call(thread, t.fn, starlark.Tuple{in, starlark.String(namespace), nsLbls, starlark.String(ctx)}, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "transform %s failed", t.ref.Name)
+	}
+	out, ok := result.(*starlark.Dict)
+	if !ok {
+		return nil, errors.Errorf("transform %s returned %s, expected dict", t.ref.Name, result.Type())
+	}
+
+	dst := src.DeepCopy()
+	if v, found, err := out.Get(starlark.String("data")); err != nil {
+		return nil, err
+	} else if found {
+		m, err := fromStarlarkDict(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "transform %s returned invalid data", t.ref.Name)
+		}
+		if encoded {
+			for k, v := range m {
+				m[k] = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+		}
+		if err := unstructured.SetNestedStringMap(dst.Object, m, "data"); err != nil {
+			return nil, err
+		}
+	}
+	if v, found, err := out.Get(starlark.String("labels")); err != nil {
+		return nil, err
+	} else if found {
+		m, err := fromStarlarkDict(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "transform %s returned invalid labels", t.ref.Name)
+		}
+		dst.SetLabels(labels.Merge(dst.GetLabels(), m))
+	}
+	if v, found, err := out.Get(starlark.String("annotations")); err != nil {
+		return nil, err
+	} else if found {
+		m, err := fromStarlarkDict(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "transform %s returned invalid annotations", t.ref.Name)
+		}
+		dst.SetAnnotations(labels.Merge(dst.GetAnnotations(), m))
+	}
+	return dst, nil
+}
+
+// targetNamespace returns a target namespace, from the cache for the source cluster.
+func (s *ConfigSyncer) targetNamespace(namespace, ctx string) (*core.Namespace, error) {
+	if ctx == "" {
+		return s.getNamespace(namespace)
+	}
+	return s.contexts[ctx].Client.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+}
+
+func toStarlarkDict(m map[string]string) (*starlark.Dict, error) {
+	d := starlark.NewDict(len(m))
+	for k, v := range m {
+		if err := d.SetKey(starlark.String(k), starlark.String(v)); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func fromStarlarkDict(v starlark.Value) (map[string]string, error) {
+	d, ok := v.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("got %s, expected dict", v.Type())
+	}
+	m := make(map[string]string, d.Len())
+	for _, item := range d.Items() {
+		k, ok := starlark.AsString(item[0])
+		if !ok {
+			return nil, fmt.Errorf("got key %s, expected string", item[0].Type())
+		}
+		v, ok := starlark.AsString(item[1])
+		if !ok {
+			return nil, fmt.Errorf("got %s for key %s, expected string", item[1].Type(), k)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
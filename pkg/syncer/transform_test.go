@@ -0,0 +1,173 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTransformConfigMap(script string) *core.ConfigMap {
+	cm := newConfigMap("demo", "customize", nil)
+	cm.Data = map[string]string{DefaultTransformKey: script}
+	return cm
+}
+
+func TestTransformApply(t *testing.T) {
+	script := `
+def transform(data, namespace, labels, context):
+    data["namespace"] = namespace
+    data["tier"] = labels.get("tier", "none")
+    return {"data": data, "labels": {"customized": "true"}}
+`
+	src := newConfigMap("demo", "omni", nil)
+	secret := &core.Secret{Data: map[string][]byte{"password": []byte("secret")}}
+	secret.Name = "creds"
+	secret.Namespace = "demo"
+	ts := newTestSyncer(t, Options{}, newTransformConfigMap(script), src, secret)
+
+	cases := []struct {
+		name string
+		r    *resourceSyncer
+		src  *unstructured.Unstructured
+		want map[string]interface{}
+	}{
+		{
+			name: "configmap",
+			r:    ts.resourceFor(ConfigMaps.GroupVersionResource),
+			src:  toUnstructured(t, src),
+			want: map[string]interface{}{"you": "only", "live": "once", "namespace": "team", "tier": "web"},
+		},
+		{
+			name: "secret",
+			r:    ts.resourceFor(Secrets.GroupVersionResource),
+			src:  toUnstructured(t, secret),
+			want: map[string]interface{}{
+				"password":  base64.StdEncoding.EncodeToString([]byte("secret")),
+				"namespace": base64.StdEncoding.EncodeToString([]byte("team")),
+				"tier":      base64.StdEncoding.EncodeToString([]byte("web")),
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tf, err := ts.loadTransform(c.r, "demo", &api.TransformRef{Name: "customize"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := tf.apply(c.r, c.src, "team", map[string]string{"tier": "web"}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.Object["data"]; !reflect.DeepEqual(got, c.want) {
+				t.Errorf("data = %v, want %v", got, c.want)
+			}
+			if got := out.GetLabels()["customized"]; got != "true" {
+				t.Errorf("customized label = %q, want true", got)
+			}
+			if _, found := c.src.GetLabels()["customized"]; found {
+				t.Errorf("apply() modified the source")
+			}
+		})
+	}
+}
+
+func TestTransformLimits(t *testing.T) {
+	cases := []struct {
+		name     string
+		script   string
+		wantLoad string
+		wantCall string
+	}{
+		{
+			name: "load",
+			script: `
+load("other.star", "helper")
+def transform(data, namespace, labels, context):
+    return {"data": data}
+`,
+			wantLoad: "load of other.star is not allowed",
+		},
+		{
+			name: "steps at load time",
+			script: `
+def spin():
+    for i in range(10000000):
+        pass
+spin()
+def transform(data, namespace, labels, context):
+    return {"data": data}
+`,
+			wantLoad: "too many steps",
+		},
+		{
+			name: "steps per call",
+			script: `
+def transform(data, namespace, labels, context):
+    for i in range(10000000):
+        pass
+    return {"data": data}
+`,
+			wantCall: "too many steps",
+		},
+		{
+			name: "missing function",
+			script: `
+def customize(data, namespace, labels, context):
+    return {"data": data}
+`,
+			wantLoad: "does not define function transform",
+		},
+		{
+			name: "invalid result",
+			script: `
+def transform(data, namespace, labels, context):
+    return "data"
+`,
+			wantCall: "returned string, expected dict",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			src := newConfigMap("demo", "omni", nil)
+			ts := newTestSyncer(t, Options{}, newTransformConfigMap(c.script), src)
+			r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+
+			tf, err := ts.loadTransform(r, "demo", &api.TransformRef{Name: "customize"})
+			if c.wantLoad != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantLoad) {
+					t.Fatalf("loadTransform() = %v, want %q", err, c.wantLoad)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = tf.apply(r, toUnstructured(t, src), "team", nil, "")
+			if err == nil || !strings.Contains(err.Error(), c.wantCall) {
+				t.Errorf("apply() = %v, want %q", err, c.wantCall)
+			}
+		})
+	}
+}
@@ -20,31 +20,63 @@ import (
 	"context"
 	"strings"
 
-	"gomodules.xyz/pointer"
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
 	"kmodules.xyz/client-go/meta"
 )
 
 type SyncOptions struct {
-	NamespaceSelector *string // if nil, delete from cluster
-	Contexts          sets.String
+	NamespaceSelectors []string // if empty, delete from cluster
+	Contexts           sets.String
+	Keys               api.KeyFilter
+	TargetName         string // if empty, copies have the name of the source
+	Transform          *api.TransformRef
+	Template           bool // render ConfigMap values as Go templates
+	ConflictPolicy     api.ConflictPolicy
 }
 
 func GetSyncOptions(annotations map[string]string) SyncOptions {
 	opts := SyncOptions{}
 	if v, err := meta.GetStringValue(annotations, ConfigSyncKey); err == nil {
 		if v == "true" {
-			opts.NamespaceSelector = pointer.StringP(labels.Everything().String())
+			opts.NamespaceSelectors = []string{labels.Everything().String()}
 		} else {
-			opts.NamespaceSelector = &v
+			opts.NamespaceSelectors = []string{v}
 		}
 	}
 	if contexts, _ := meta.GetStringValue(annotations, ConfigSyncContexts); contexts != "" {
 		opts.Contexts = sets.NewString(strings.Split(contexts, ",")...)
 	}
+	if v, _ := meta.GetStringValue(annotations, ConfigIncludeKeys); v != "" {
+		opts.Keys.Include = parseKeyPatterns(v)
+	}
+	if v, _ := meta.GetStringValue(annotations, ConfigExcludeKeys); v != "" {
+		opts.Keys.Exclude = parseKeyPatterns(v)
+	}
+	if v, _ := meta.GetStringValue(annotations, ConfigRenameKeys); v != "" {
+		if renames, err := parseKeyRenames(v); err != nil {
+			klog.Errorf("ignoring %s annotation: %v", ConfigRenameKeys, err)
+		} else {
+			opts.Keys.Rename = renames
+		}
+	}
+	opts.TargetName, _ = meta.GetStringValue(annotations, ConfigTargetName)
+	opts.Template, _ = meta.GetBoolValue(annotations, ConfigTemplate)
+	if v, _ := meta.GetStringValue(annotations, ConfigConflictPolicy); v != "" {
+		opts.ConflictPolicy = api.ConflictPolicy(v)
+	}
+	if v, _ := meta.GetStringValue(annotations, ConfigTransform); v != "" {
+		if ref, err := parseTransformRef(v); err != nil {
+			klog.Errorf("ignoring %s annotation: %v", ConfigTransform, err)
+		} else {
+			opts.Transform = ref
+		}
+	}
 	return opts
 }
 
@@ -61,3 +93,30 @@ func NamespacesForSelector(kc kubernetes.Interface, selector string) (sets.Strin
 	}
 	return ns, nil
 }
+
+// NamespacesForSelectors returns the namespaces matching any of the given selectors.
+func NamespacesForSelectors(kc kubernetes.Interface, selectors []string) (sets.String, error) {
+	ns := sets.NewString()
+	for _, selector := range selectors {
+		matched, err := NamespacesForSelector(kc, selector)
+		if err != nil {
+			return nil, err
+		}
+		ns = ns.Union(matched)
+	}
+	return ns, nil
+}
+
+// SelectorsMatch returns true if the labels match any of the given selectors.
+func SelectorsMatch(selectors []string, lbls map[string]string) (bool, error) {
+	for _, s := range selectors {
+		selector, err := labels.Parse(s)
+		if err != nil {
+			return false, err
+		}
+		if selector.Matches(labels.Set(lbls)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ValidateSource checks the sync annotations of obj on behalf of the validating admission webhook.
+// old is nil on create. Objects whose sync annotations did not change are always accepted, so
+// updates of the data of a source never fail because a context was removed later on.
+func (s *ConfigSyncer) ValidateSource(gvr schema.GroupVersionResource, old, obj metav1.Object) error {
+	r := s.resourceFor(gvr)
+	if r == nil || (old != nil && !syncAnnotationsChanged(old, obj)) {
+		return nil
+	}
+
+	annotations := obj.GetAnnotations()
+	var errs []error
+	if v, ok := annotations[ConfigSyncKey]; ok && v != "true" {
+		if _, err := labels.Parse(v); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s annotation", ConfigSyncKey))
+		}
+	}
+	if v := annotations[ConfigRenameKeys]; v != "" {
+		if _, err := parseKeyRenames(v); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s annotation", ConfigRenameKeys))
+		}
+	}
+	if v := annotations[ConfigTransform]; v != "" {
+		if _, err := parseTransformRef(v); err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid %s annotation", ConfigTransform))
+		}
+	}
+
+	opts := GetSyncOptions(annotations)
+	if err := ValidateKeyFilter(opts.Keys); err != nil {
+		errs = append(errs, err)
+	} else if u, ok := obj.(*unstructured.Unstructured); ok {
+		if err := r.Strategy.MapKeys(u.DeepCopy(), opts.Keys); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if opts.TargetName != "" {
+		if msgs := validation.IsDNS1123Subdomain(opts.TargetName); len(msgs) > 0 {
+			errs = append(errs, errors.Errorf("invalid target name %q: %s", opts.TargetName, strings.Join(msgs, ", ")))
+		}
+	}
+	if opts.ConflictPolicy != "" {
+		if err := ValidateConflictPolicy(opts.ConflictPolicy); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if opts.Template && r.GroupVersionResource != ConfigMaps.GroupVersionResource {
+		errs = append(errs, errors.Errorf("templates are not supported for %s", r.Kind))
+	}
+
+	if hasSyncAnnotations(obj) {
+		errs = append(errs, s.validateTargets(r, obj, opts)...)
+		if s.authorizeSyncs {
+			if err := s.verifyRequesterStamp(r, obj); err != nil {
+				errs = append(errs, err)
+			}
+			if err := s.validateContextsGranted(r, obj, opts); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateContextsGranted checks that every context of obj is selected by a SyncPolicy, since the requester
+// of a sync can not be authorized in remote clusters.
+func (s *ConfigSyncer) validateContextsGranted(r *resourceSyncer, obj metav1.Object, opts SyncOptions) error {
+	granted := sets.NewString()
+	for _, policy := range s.syncPoliciesFor(r.SourceKind(), obj) {
+		granted.Insert(policy.Spec.Target.Contexts...)
+	}
+	if refused := opts.Contexts.Difference(granted); refused.Len() > 0 {
+		return errors.Errorf("contexts %s are not selected by a SyncPolicy, contexts can only be selected by a SyncPolicy when syncs are authorized", strings.Join(refused.List(), ", "))
+	}
+	return nil
+}
+
+// validateTargets checks the contexts of opts and the targets of obj against the operator policy.
+func (s *ConfigSyncer) validateTargets(r *resourceSyncer, obj metav1.Object, opts SyncOptions) []error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var errs []error
+	if !s.policy.AllowsSource(obj.GetNamespace()) {
+		errs = append(errs, errors.Errorf("namespace %s may not be a sync source", obj.GetNamespace()))
+	}
+
+	addresses := map[string]string{}
+	for _, name := range opts.Contexts.List() {
+		ctx, found := s.contexts[name]
+		if !found {
+			errs = append(errs, errors.Errorf("context %s not found", name))
+			continue
+		}
+		if other, found := addresses[ctx.Address]; found {
+			errs = append(errs, errors.Errorf("contexts %s and %s point to the same cluster", other, name))
+			continue
+		}
+		addresses[ctx.Address] = name
+		namespace := ctx.Namespace
+		if namespace == "" {
+			namespace = obj.GetNamespace()
+		}
+		if s.policy.DeniesTarget(namespace) {
+			errs = append(errs, errors.Errorf("namespace %s of context %s may not receive copies", namespace, name))
+		}
+	}
+
+	if s.policy != nil && s.policy.MaxFanOut > 0 && len(errs) == 0 {
+		ns := sets.NewString()
+		if len(opts.NamespaceSelectors) > 0 {
+			var err error
+			if ns, err = s.namespacesForSelectors(r.Kind, opts.NamespaceSelectors, obj); err != nil {
+				return append(errs, err)
+			}
+		}
+		if opts.TargetName == "" || opts.TargetName == obj.GetName() {
+			// the source is never copied over itself
+			ns.Delete(obj.GetNamespace())
+		}
+		if n := ns.Len() + opts.Contexts.Len(); s.policy.ExceedsFanOut(n) {
+			errs = append(errs, errors.Errorf("selects %d targets, at most %d are allowed", n, s.policy.MaxFanOut))
+		}
+	}
+	return errs
+}
+
+// syncAnnotationsChanged returns true if any annotation that controls syncing differs between old and obj.
+func syncAnnotationsChanged(old, obj metav1.Object) bool {
+	for _, key := range syncAnnotationKeys.List() {
+		v1, ok1 := old.GetAnnotations()[key]
+		v2, ok2 := obj.GetAnnotations()[key]
+		if ok1 != ok2 || v1 != v2 {
+			return true
+		}
+	}
+	return false
+}
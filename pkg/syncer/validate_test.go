@@ -0,0 +1,198 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"strings"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateSource(t *testing.T) {
+	source := func(annotations map[string]string) *core.ConfigMap {
+		return newConfigMap("demo", "omni", annotations)
+	}
+
+	cases := []struct {
+		name    string
+		opts    Options
+		old     *core.ConfigMap
+		obj     *core.ConfigMap
+		secret  bool
+		wantErr string
+	}{
+		{
+			name: "valid",
+			obj:  source(map[string]string{ConfigSyncKey: "app=demo", ConfigSyncContexts: "prod", ConfigTargetName: "shared"}),
+		},
+		{
+			name: "no sync annotations",
+			obj:  source(map[string]string{"note": "not synced"}),
+		},
+		{
+			name:    "invalid selector",
+			obj:     source(map[string]string{ConfigSyncKey: "app in (demo"}),
+			wantErr: "invalid " + ConfigSyncKey + " annotation",
+		},
+		{
+			name:    "unknown context",
+			obj:     source(map[string]string{ConfigSyncContexts: "staging"}),
+			wantErr: "context staging not found",
+		},
+		{
+			name:    "contexts of the same cluster",
+			obj:     source(map[string]string{ConfigSyncContexts: "prod,prod-alias"}),
+			wantErr: "point to the same cluster",
+		},
+		{
+			name: "unchanged sync annotations",
+			old:  source(map[string]string{ConfigSyncContexts: "staging"}),
+			obj:  source(map[string]string{ConfigSyncContexts: "staging", "note": "changed"}),
+		},
+		{
+			name:    "changed sync annotations",
+			old:     source(map[string]string{ConfigSyncContexts: "prod"}),
+			obj:     source(map[string]string{ConfigSyncContexts: "staging"}),
+			wantErr: "context staging not found",
+		},
+		{
+			name:    "invalid target name",
+			obj:     source(map[string]string{ConfigSyncKey: "true", ConfigTargetName: "Shared_Config"}),
+			wantErr: "invalid target name",
+		},
+		{
+			name:    "invalid conflict policy",
+			obj:     source(map[string]string{ConfigSyncKey: "true", ConfigConflictPolicy: "ignore"}),
+			wantErr: "ignore",
+		},
+		{
+			name:    "template on a secret",
+			obj:     source(map[string]string{ConfigSyncKey: "true", ConfigTemplate: "true"}),
+			secret:  true,
+			wantErr: "templates are not supported for Secret",
+		},
+		{
+			name:    "source namespace not allowed",
+			opts:    Options{Policy: &OperatorPolicy{SourceNamespaces: []string{"team-*"}}},
+			obj:     source(map[string]string{ConfigSyncKey: "true"}),
+			wantErr: "namespace demo may not be a sync source",
+		},
+		{
+			name:    "denied context namespace",
+			opts:    Options{Policy: &OperatorPolicy{DeniedTargetNamespaces: []string{"kube-system"}}},
+			obj:     source(map[string]string{ConfigSyncContexts: "prod"}),
+			wantErr: "namespace kube-system of context prod may not receive copies",
+		},
+		{
+			name:    "fan-out exceeded",
+			opts:    Options{Policy: &OperatorPolicy{MaxFanOut: 1}},
+			obj:     source(map[string]string{ConfigSyncKey: "true", ConfigSyncContexts: "prod"}),
+			wantErr: "selects 2 targets, at most 1 are allowed",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := newTestSyncer(t, c.opts, newNamespace("demo", nil, nil), newNamespace("team", nil, nil))
+			ts.lock.Lock()
+			ts.fileContexts = map[string]clusterContext{
+				"prod":       {Client: kfake.NewSimpleClientset(), Address: "https://prod", Namespace: "kube-system"},
+				"prod-alias": {Client: kfake.NewSimpleClientset(), Address: "https://prod"},
+			}
+			ts.rebuildContexts()
+			ts.lock.Unlock()
+
+			gvr := ConfigMaps.GroupVersionResource
+			obj := toUnstructured(t, c.obj)
+			if c.secret {
+				gvr = Secrets.GroupVersionResource
+				obj = toUnstructured(t, &core.Secret{ObjectMeta: c.obj.ObjectMeta})
+			}
+			var old metav1.Object
+			if c.old != nil {
+				old = toUnstructured(t, c.old)
+			}
+			err := ts.ValidateSource(gvr, old, obj)
+			if c.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateSource() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("ValidateSource() = %v, want error containing %q", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAuthorizedSource(t *testing.T) {
+	alice := authenticationv1.UserInfo{Username: "alice"}
+	cases := []struct {
+		name    string
+		src     *core.ConfigMap
+		stamp   bool
+		wantErr string
+	}{
+		{
+			name:  "stamped",
+			src:   newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true"}),
+			stamp: true,
+		},
+		{
+			name:    "not stamped",
+			src:     newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "true", ConfigRequestedBy: `{"username":"alice"}`}),
+			wantErr: "was not stamped by the admission webhook",
+		},
+		{
+			name:    "context not granted",
+			src:     newConfigMap("demo", "omni", map[string]string{ConfigSyncContexts: "prod"}),
+			stamp:   true,
+			wantErr: "contexts prod are not selected by a SyncPolicy",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := newTestSyncer(t, Options{AuthorizeSyncs: true, RequesterKey: testRequesterKey}, newNamespace("demo", nil, nil))
+			ts.reloadRequesterWebhooks([]admissionregistrationv1.MutatingWebhookConfiguration{*newRequesterWebhook(nil, "configmaps", "secrets")})
+			ts.lock.Lock()
+			ts.fileContexts = map[string]clusterContext{
+				"prod": {Client: kfake.NewSimpleClientset(), Address: "https://prod"},
+			}
+			ts.rebuildContexts()
+			ts.lock.Unlock()
+			if c.stamp {
+				ts.stamp(t, c.src, alice)
+			}
+
+			err := ts.ValidateSource(ConfigMaps.GroupVersionResource, nil, toUnstructured(t, c.src))
+			if c.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateSource() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("ValidateSource() = %v, want error containing %q", err, c.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"sort"
+	"strings"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+	syncerapi "kubeops.dev/config-syncer/apis/syncer/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+)
+
+// syncedObjectName returns the name of the SyncedObject of a source.
+func syncedObjectName(kind, name string) string {
+	return name + "." + strings.ToLower(kind)
+}
+
+// SyncedObjects returns the sources in namespace that are synced via annotations or SyncPolicies.
+// If namespace is empty, the sources of all namespaces are returned.
+func (s *ConfigSyncer) SyncedObjects(namespace string) ([]syncerapi.SyncedObject, error) {
+	var out []syncerapi.SyncedObject
+	for _, r := range s.resources {
+		var objs []interface{}
+		if namespace == "" {
+			objs = r.indexer.List()
+		} else {
+			var err error
+			if objs, err = r.indexer.ByIndex(cache.NamespaceIndex, namespace); err != nil {
+				return nil, err
+			}
+		}
+		for _, obj := range objs {
+			src := obj.(*unstructured.Unstructured)
+			if isSyncStatus(src) {
+				continue
+			}
+			so, err := s.syncedObject(r, src)
+			if err != nil {
+				return nil, err
+			}
+			if so != nil {
+				out = append(out, *so)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+// SyncedObject returns a SyncedObject by name, or nil if the source does not exist or is not synced.
+func (s *ConfigSyncer) SyncedObject(namespace, name string) (*syncerapi.SyncedObject, error) {
+	idx := strings.LastIndex(name, ".")
+	if idx < 0 {
+		return nil, nil
+	}
+	for _, r := range s.resources {
+		if strings.ToLower(r.Kind) != name[idx+1:] {
+			continue
+		}
+		obj, exists, err := r.indexer.GetByKey(namespace + "/" + name[:idx])
+		if err != nil || !exists || isSyncStatus(obj.(*unstructured.Unstructured)) {
+			return nil, err
+		}
+		return s.syncedObject(r, obj.(*unstructured.Unstructured))
+	}
+	return nil, nil
+}
+
+func (s *ConfigSyncer) syncedObject(r *resourceSyncer, src *unstructured.Unstructured) (*syncerapi.SyncedObject, error) {
+	opts := s.syncOptionsFor(r.SourceKind(), src)
+	if len(opts.NamespaceSelectors) == 0 && opts.Contexts.Len() == 0 {
+		return nil, nil
+	}
+	targetName := opts.TargetName
+	if targetName == "" {
+		targetName = src.GetName()
+	}
+
+	namespaces := sets.NewString()
+	var contexts []string
+	if s.policy.AllowsSource(src.GetNamespace()) {
+		if len(opts.NamespaceSelectors) > 0 {
+			ns, err := s.namespacesForSelectors(r.Kind, opts.NamespaceSelectors, src)
+			if err != nil {
+				return nil, err
+			}
+			if targetName == src.GetName() {
+				ns.Delete(src.GetNamespace())
+			}
+			namespaces = ns
+		}
+		contexts = opts.Contexts.List()
+	}
+
+	status, err := s.readSyncStatus(src)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		status = &api.SyncStatus{}
+	}
+
+	obj := &syncerapi.SyncedObject{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: syncerapi.SchemeGroupVersion.String(),
+			Kind:       syncerapi.ResourceKindSyncedObject,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              syncedObjectName(r.Kind, src.GetName()),
+			Namespace:         src.GetNamespace(),
+			Labels:            src.GetLabels(),
+			CreationTimestamp: src.GetCreationTimestamp(),
+		},
+		Spec: syncerapi.SyncedObjectSpec{
+			Source: syncerapi.SourceReference{
+				APIGroup:        r.Group,
+				Kind:            r.Kind,
+				Name:            src.GetName(),
+				ResourceVersion: src.GetResourceVersion(),
+			},
+			TargetName: targetName,
+			Namespaces: namespaces.List(),
+			Contexts:   contexts,
+		},
+		Status: syncerapi.SyncedObjectStatus{
+			Targets: status.Targets,
+		},
+	}
+	obj.Status.Phase = syncedObjectPhase(src.GetResourceVersion(), namespaces, contexts, status.Targets)
+	return obj, nil
+}
+
+// syncedObjectPhase summarises the targets recorded for a source at resourceVersion.
+func syncedObjectPhase(resourceVersion string, namespaces sets.String, contexts []string, targets []api.TargetStatus) syncerapi.SyncedObjectPhase {
+	done := sets.NewString()
+	for _, t := range targets {
+		switch {
+		case t.Phase == api.TargetPhaseFailed:
+			return syncerapi.SyncedObjectPhaseFailed
+		case t.Phase == api.TargetPhaseSkipped,
+			t.Phase == api.TargetPhaseSynced && t.ResourceVersion == resourceVersion:
+			if t.Context == "" {
+				done.Insert(t.Namespace)
+			} else {
+				done.Insert("context:" + t.Context)
+			}
+		}
+	}
+	for _, ns := range namespaces.List() {
+		if !done.Has(ns) {
+			return syncerapi.SyncedObjectPhasePending
+		}
+	}
+	for _, ctx := range contexts {
+		if !done.Has("context:" + ctx) {
+			return syncerapi.SyncedObjectPhasePending
+		}
+	}
+	return syncerapi.SyncedObjectPhaseSynced
+}
+
+// ClusterContexts returns the remote contexts sources can be synced into, sorted by name.
+func (s *ConfigSyncer) ClusterContexts() []syncerapi.ClusterContext {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	secrets := map[string]string{}
+	for key, contexts := range s.secretContexts {
+		for name := range contexts {
+			secrets[name] = key
+		}
+	}
+
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+
+	out := make([]syncerapi.ClusterContext, 0, len(s.contexts))
+	for name, ctx := range s.contexts {
+		cc := syncerapi.ClusterContext{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: syncerapi.SchemeGroupVersion.String(),
+				Kind:       syncerapi.ResourceKindClusterContext,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: syncerapi.ClusterContextSpec{
+				Cluster:   ctx.Cluster,
+				Address:   ctx.Address,
+				Namespace: ctx.Namespace,
+			},
+			Status: syncerapi.ClusterContextStatus{
+				Healthy: true,
+			},
+		}
+		if _, found := s.fileContexts[name]; !found {
+			cc.Spec.Secret = secrets[name]
+		}
+		if h, found := s.health[name]; found {
+			cc.Status.Healthy = !h.open
+			cc.Status.ConsecutiveFailures = h.failures
+			if h.lastErr != nil {
+				cc.Status.LastError = h.lastErr.Error()
+			}
+		}
+		out = append(out, cc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
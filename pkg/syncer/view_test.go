@@ -0,0 +1,184 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+	syncerapi "kubeops.dev/config-syncer/apis/syncer/v1alpha1"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSyncedObjects(t *testing.T) {
+	src := newConfigMap("demo", "omni", map[string]string{ConfigSyncKey: "app=demo"})
+	src.ResourceVersion = "7"
+	ts := newTestSyncer(t, Options{},
+		newNamespace("demo", map[string]string{"app": "demo"}, nil),
+		newNamespace("team", map[string]string{"app": "demo"}, nil),
+		newNamespace("other", nil, nil),
+		src,
+		newConfigMap("demo", "plain", nil),
+		newConfigMap("team", "renamed", map[string]string{ConfigSyncKey: "true", ConfigTargetName: "shared"}),
+	)
+
+	objs, err := ts.SyncedObjects("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, so := range objs {
+		names = append(names, so.Namespace+"/"+so.Name)
+	}
+	if want := []string{"demo/omni.configmap", "team/renamed.configmap"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("SyncedObjects() = %v, want %v", names, want)
+	}
+	if objs, err := ts.SyncedObjects("team"); err != nil || len(objs) != 1 {
+		t.Errorf("SyncedObjects(team) = %v, %v, want a single object", objs, err)
+	}
+
+	so, err := ts.SyncedObject("team", "renamed.configmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the source namespace receives a copy under the target name
+	if so == nil || so.Spec.TargetName != "shared" || !reflect.DeepEqual(so.Spec.Namespaces, []string{"demo", "other", "team"}) {
+		t.Errorf("SyncedObject() = %+v, want copies named shared in every namespace", so)
+	}
+	for _, name := range []string{"plain.configmap", "omni.secret", "omni"} {
+		if so, err := ts.SyncedObject("demo", name); err != nil || so != nil {
+			t.Errorf("SyncedObject(%s) = %v, %v, want nil", name, so, err)
+		}
+	}
+
+	so, err = ts.SyncedObject("demo", "omni.configmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if so.Spec.Source.ResourceVersion != "7" || !reflect.DeepEqual(so.Spec.Namespaces, []string{"team"}) || so.Status.Phase != syncerapi.SyncedObjectPhasePending {
+		t.Errorf("SyncedObject() = %+v, want a pending sync into team", so)
+	}
+
+	// the sync status is read from the cache, just like the sources
+	r := ts.resourceFor(ConfigMaps.GroupVersionResource)
+	if err := ts.sync(r, toUnstructured(t, src)); err != nil {
+		t.Fatal(err)
+	}
+	status, err := ts.kc.CoreV1().ConfigMaps("demo").Get(context.TODO(), syncStatusName("ConfigMap", "omni"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.cache(t, status)
+	if so, err = ts.SyncedObject("demo", "omni.configmap"); err != nil {
+		t.Fatal(err)
+	}
+	if so.Status.Phase != syncerapi.SyncedObjectPhaseSynced || len(so.Status.Targets) != 1 {
+		t.Errorf("SyncedObject() = %+v, want the sync into team to be done", so)
+	}
+	if so, err := ts.SyncedObject("demo", syncStatusName("ConfigMap", "omni")+".configmap"); err != nil || so != nil {
+		t.Errorf("SyncedObject() = %v, %v, want sync status ConfigMaps to be hidden", so, err)
+	}
+}
+
+func TestSyncedObjectPhase(t *testing.T) {
+	synced := func(ctx, ns, rv string) api.TargetStatus {
+		return api.TargetStatus{Context: ctx, Namespace: ns, Phase: api.TargetPhaseSynced, ResourceVersion: rv}
+	}
+	cases := []struct {
+		name     string
+		contexts []string
+		targets  []api.TargetStatus
+		want     syncerapi.SyncedObjectPhase
+	}{
+		{
+			name:    "synced",
+			targets: []api.TargetStatus{synced("", "team", "2"), synced("", "ops", "2")},
+			want:    syncerapi.SyncedObjectPhaseSynced,
+		},
+		{
+			name:    "missing target",
+			targets: []api.TargetStatus{synced("", "team", "2")},
+			want:    syncerapi.SyncedObjectPhasePending,
+		},
+		{
+			name:    "stale target",
+			targets: []api.TargetStatus{synced("", "team", "2"), synced("", "ops", "1")},
+			want:    syncerapi.SyncedObjectPhasePending,
+		},
+		{
+			name:    "skipped target",
+			targets: []api.TargetStatus{synced("", "team", "2"), {Namespace: "ops", Phase: api.TargetPhaseSkipped}},
+			want:    syncerapi.SyncedObjectPhaseSynced,
+		},
+		{
+			name:    "failed target",
+			targets: []api.TargetStatus{synced("", "team", "2"), {Namespace: "ops", Phase: api.TargetPhaseFailed}},
+			want:    syncerapi.SyncedObjectPhaseFailed,
+		},
+		{
+			name:     "context pending",
+			contexts: []string{"prod"},
+			targets:  []api.TargetStatus{synced("", "team", "2"), synced("", "ops", "2"), synced("staging", "team", "2")},
+			want:     syncerapi.SyncedObjectPhasePending,
+		},
+		{
+			name:     "context synced",
+			contexts: []string{"prod"},
+			targets:  []api.TargetStatus{synced("", "team", "2"), synced("", "ops", "2"), synced("prod", "demo", "2")},
+			want:     syncerapi.SyncedObjectPhaseSynced,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := syncedObjectPhase("2", sets.NewString("team", "ops"), c.contexts, c.targets); got != c.want {
+				t.Errorf("syncedObjectPhase() = %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestClusterContexts(t *testing.T) {
+	ts := newTestSyncer(t, Options{})
+	ts.lock.Lock()
+	ts.fileContexts = map[string]clusterContext{
+		"prod": {Client: kfake.NewSimpleClientset(), Address: "https://prod", Cluster: "prod"},
+	}
+	ts.secretContexts["kube-system/staging"] = map[string]clusterContext{
+		"staging": {Client: kfake.NewSimpleClientset(), Address: "https://staging", Cluster: "staging", Namespace: "apps"},
+	}
+	ts.rebuildContexts()
+	ts.lock.Unlock()
+	ts.health["staging"] = &contextHealth{failures: 3, open: true, lastErr: errors.New("connection refused")}
+
+	got := ts.ClusterContexts()
+	if len(got) != 2 {
+		t.Fatalf("ClusterContexts() = %+v, want 2 contexts", got)
+	}
+	if prod := got[0]; prod.Name != "prod" || prod.Spec.Secret != "" || !prod.Status.Healthy || prod.Spec.Address != "https://prod" {
+		t.Errorf("prod = %+v, want a healthy context from the kubeconfig file", prod)
+	}
+	want := syncerapi.ClusterContextStatus{ConsecutiveFailures: 3, LastError: "connection refused"}
+	if staging := got[1]; staging.Name != "staging" || staging.Spec.Secret != "kube-system/staging" || staging.Spec.Namespace != "apps" || staging.Status != want {
+		t.Errorf("staging = %+v, want an unhealthy context from the cluster secret", staging)
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright The Config Syncer Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_test
+
+import (
+	"context"
+	"time"
+
+	api "kubeops.dev/config-syncer/apis/config/v1alpha1"
+	"kubeops.dev/config-syncer/pkg/syncer"
+	"kubeops.dev/config-syncer/test/e2e/framework"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+	"kmodules.xyz/client-go/meta"
+)
+
+// how long a target is watched to make sure the syncer leaves it alone
+const settleTimeout = 20 * time.Second
+
+var _ = Describe("Sync Annotations", func() {
+	var (
+		f      *framework.Invocation
+		cfgMap *core.ConfigMap
+		target *core.Namespace
+	)
+
+	BeforeEach(func() {
+		f = root.Invoke()
+		cfgMap = f.NewConfigMap()
+		target = f.NewNamespaceWithLabel()
+		metav1.SetMetaDataAnnotation(&cfgMap.ObjectMeta, syncer.ConfigSyncKey, "app="+f.App())
+	})
+
+	AfterEach(func() {
+		f.DeleteAllConfigmaps()
+
+		err := f.DeleteNamespace(target.Name)
+		if kerr.IsNotFound(err) {
+			err = nil
+		}
+		Expect(err).NotTo(HaveOccurred())
+		f.EventuallyNamespaceDeleted(target.Name).Should(BeTrue())
+	})
+
+	createTargetAndSource := func() *core.ConfigMap {
+		By("Creating target namespace")
+		err := f.CreateNamespace(target)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Creating source configMap")
+		source, err := f.CreateConfigMap(cfgMap)
+		Expect(err).NotTo(HaveOccurred())
+		return source
+	}
+
+	Context("Target Name", func() {
+		It("should sync configMap under the target name", func() {
+			metav1.SetMetaDataAnnotation(&cfgMap.ObjectMeta, syncer.ConfigTargetName, cfgMap.Name+"-copy")
+			source := createTargetAndSource()
+
+			By("Checking configMap has synced under the target name")
+			f.EventuallyConfigMapData(target.Name, source.Name+"-copy").Should(Equal(source.Data))
+
+			By("Checking configMap has not synced under the source name")
+			f.EventuallyConfigMapSyncedToNamespace(source, target.Name).Should(BeFalse())
+		})
+	})
+
+	Context("Key Filters", func() {
+		It("should sync the included keys only", func() {
+			metav1.SetMetaDataAnnotation(&cfgMap.ObjectMeta, syncer.ConfigIncludeKeys, "you")
+			source := createTargetAndSource()
+
+			By("Checking the copy has the included keys")
+			f.EventuallyConfigMapData(target.Name, source.Name).Should(Equal(map[string]string{"you": "only"}))
+
+			By("Excluding a key instead")
+			source, _, err := core_util.PatchConfigMap(context.TODO(), f.KubeClient, source, func(obj *core.ConfigMap) *core.ConfigMap {
+				obj.Annotations = meta.RemoveKey(obj.Annotations, syncer.ConfigIncludeKeys)
+				metav1.SetMetaDataAnnotation(&obj.ObjectMeta, syncer.ConfigExcludeKeys, "you")
+				return obj
+			}, metav1.PatchOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the copy lacks the excluded keys")
+			f.EventuallyConfigMapData(target.Name, source.Name).Should(Equal(map[string]string{"live": "once"}))
+		})
+
+		It("should rename keys", func() {
+			metav1.SetMetaDataAnnotation(&cfgMap.ObjectMeta, syncer.ConfigRenameKeys, "you=we")
+			source := createTargetAndSource()
+
+			By("Checking the copy has the renamed keys")
+			f.EventuallyConfigMapData(target.Name, source.Name).Should(Equal(map[string]string{"we": "only", "live": "once"}))
+		})
+
+		It("should not sync keys renamed into copied keys", func() {
+			metav1.SetMetaDataAnnotation(&cfgMap.ObjectMeta, syncer.ConfigRenameKeys, "you=live")
+			source := createTargetAndSource()
+
+			By("Checking configMap has not synced")
+			Consistently(func() bool {
+				_, err := f.KubeClient.CoreV1().ConfigMaps(target.Name).Get(context.TODO(), source.Name, metav1.GetOptions{})
+				return kerr.IsNotFound(err)
+			}, settleTimeout).Should(BeTrue())
+		})
+	})
+
+	Context("Namespace Opt-Out", func() {
+		It("should not sync into namespaces that opted out", func() {
+			metav1.SetMetaDataAnnotation(&target.ObjectMeta, syncer.NamespaceExcludeKey, "configmap/"+cfgMap.Namespace+"/"+cfgMap.Name)
+			source := createTargetAndSource()
+
+			By("Checking configMap has not synced to the namespace")
+			Consistently(func() bool {
+				_, err := f.KubeClient.CoreV1().ConfigMaps(target.Name).Get(context.TODO(), source.Name, metav1.GetOptions{})
+				return kerr.IsNotFound(err)
+			}, settleTimeout).Should(BeTrue())
+
+			By("Opting the namespace back in")
+			ns, err := f.KubeClient.CoreV1().Namespaces().Get(context.TODO(), target.Name, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			ns.Annotations = meta.RemoveKey(ns.Annotations, syncer.NamespaceExcludeKey)
+			_, err = f.KubeClient.CoreV1().Namespaces().Update(context.TODO(), ns, metav1.UpdateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking configMap has synced to the namespace")
+			f.EventuallyConfigMapSyncedToNamespace(source, target.Name).Should(BeTrue())
+		})
+	})
+
+	Context("Unmanaged Copy", func() {
+		It("should not update or delete unmanaged copies", func() {
+			source := createTargetAndSource()
+
+			By("Checking configMap has synced")
+			f.EventuallyConfigMapSyncedToNamespace(source, target.Name).Should(BeTrue())
+
+			By("Marking the copy unmanaged")
+			copied, err := f.KubeClient.CoreV1().ConfigMaps(target.Name).Get(context.TODO(), source.Name, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			_, _, err = core_util.PatchConfigMap(context.TODO(), f.KubeClient, copied, func(obj *core.ConfigMap) *core.ConfigMap {
+				metav1.SetMetaDataAnnotation(&obj.ObjectMeta, syncer.UnmanagedKey, "true")
+				obj.Data = map[string]string{"local": "edit"}
+				return obj
+			}, metav1.PatchOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Removing sync annotation")
+			source, err = f.KubeClient.CoreV1().ConfigMaps(source.Namespace).Get(context.TODO(), source.Name, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			_, _, err = core_util.PatchConfigMap(context.TODO(), f.KubeClient, source, func(obj *core.ConfigMap) *core.ConfigMap {
+				obj.Annotations = meta.RemoveKey(obj.Annotations, syncer.ConfigSyncKey)
+				return obj
+			}, metav1.PatchOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the copy is kept as it is")
+			Consistently(func() map[string]string {
+				cm, err := f.KubeClient.CoreV1().ConfigMaps(target.Name).Get(context.TODO(), source.Name, metav1.GetOptions{})
+				if err != nil {
+					return nil
+				}
+				return cm.Data
+			}, settleTimeout).Should(Equal(map[string]string{"local": "edit"}))
+		})
+	})
+
+	Context("Conflict Policy", func() {
+		It("should not overwrite existing objects with the skip policy", func() {
+			metav1.SetMetaDataAnnotation(&cfgMap.ObjectMeta, syncer.ConfigConflictPolicy, string(api.ConflictPolicySkip))
+
+			By("Creating target namespace")
+			err := f.CreateNamespace(target)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Creating an object owned by the target namespace")
+			local := f.NewConfigMap()
+			local.Namespace = target.Name
+			local.Data = map[string]string{"owned": "locally"}
+			_, err = f.CreateConfigMap(local)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Creating source configMap")
+			source, err := f.CreateConfigMap(cfgMap)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the existing object is left alone")
+			Consistently(func() map[string]string {
+				cm, err := f.KubeClient.CoreV1().ConfigMaps(target.Name).Get(context.TODO(), source.Name, metav1.GetOptions{})
+				if err != nil {
+					return nil
+				}
+				return cm.Data
+			}, settleTimeout).Should(Equal(local.Data))
+		})
+	})
+
+	Context("Sync Status", func() {
+		It("should record the targets of the source", func() {
+			source := createTargetAndSource()
+
+			By("Checking configMap has synced")
+			f.EventuallyConfigMapSyncedToNamespace(source, target.Name).Should(BeTrue())
+
+			By("Checking the sync status lists the target namespace")
+			name := source.Name + ".configmap.sync-status"
+			Eventually(func() string {
+				cm, err := f.KubeClient.CoreV1().ConfigMaps(source.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+				if err != nil {
+					return ""
+				}
+				return cm.Data[syncer.SyncStatusKey]
+			}).Should(ContainSubstring(`"namespace":"` + target.Name + `"`))
+		})
+	})
+})
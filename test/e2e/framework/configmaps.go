@@ -83,8 +83,8 @@ func (fi *Invocation) EventuallyConfigMapSynced(source *core.ConfigMap) GomegaAs
 	opt := syncer.GetSyncOptions(source.Annotations)
 
 	return Eventually(func() bool {
-		if opt.NamespaceSelector != nil {
-			namespaces, err := syncer.NamespacesForSelector(fi.KubeClient, *opt.NamespaceSelector)
+		if len(opt.NamespaceSelectors) > 0 {
+			namespaces, err := syncer.NamespacesForSelectors(fi.KubeClient, opt.NamespaceSelectors)
 			Expect(err).NotTo(HaveOccurred())
 
 			for _, ns := range namespaces.List() {
@@ -127,12 +127,23 @@ func (fi *Invocation) EventuallyConfigMapSyncedToNamespace(source *core.ConfigMa
 	})
 }
 
+// EventuallyConfigMapData returns the data of a ConfigMap, or nil while it does not exist.
+func (fi *Invocation) EventuallyConfigMapData(namespace, name string) GomegaAsyncAssertion {
+	return Eventually(func() map[string]string {
+		cm, err := fi.KubeClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil
+		}
+		return cm.Data
+	})
+}
+
 func (fi *Invocation) EventuallySyncedConfigMapsUpdated(source *core.ConfigMap) GomegaAsyncAssertion {
 	opt := syncer.GetSyncOptions(source.Annotations)
 
 	return Eventually(func() bool {
-		if opt.NamespaceSelector != nil {
-			namespaces, err := syncer.NamespacesForSelector(fi.KubeClient, *opt.NamespaceSelector)
+		if len(opt.NamespaceSelectors) > 0 {
+			namespaces, err := syncer.NamespacesForSelectors(fi.KubeClient, opt.NamespaceSelectors)
 			Expect(err).NotTo(HaveOccurred())
 
 			for _, ns := range namespaces.List() {
@@ -158,8 +169,8 @@ func (fi *Invocation) EventuallySyncedConfigMapsDeleted(source *core.ConfigMap)
 	opt := syncer.GetSyncOptions(source.Annotations)
 
 	return Eventually(func() bool {
-		if opt.NamespaceSelector != nil {
-			namespaces, err := syncer.NamespacesForSelector(fi.KubeClient, *opt.NamespaceSelector)
+		if len(opt.NamespaceSelectors) > 0 {
+			namespaces, err := syncer.NamespacesForSelectors(fi.KubeClient, opt.NamespaceSelectors)
 			Expect(err).NotTo(HaveOccurred())
 
 			for _, ns := range namespaces.List() {
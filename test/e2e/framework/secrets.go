@@ -82,8 +82,8 @@ func (fi *Invocation) EventuallySecretSynced(source *core.Secret) GomegaAsyncAss
 	opt := syncer.GetSyncOptions(source.Annotations)
 
 	return Eventually(func() bool {
-		if opt.NamespaceSelector != nil {
-			namespaces, err := syncer.NamespacesForSelector(fi.KubeClient, *opt.NamespaceSelector)
+		if len(opt.NamespaceSelectors) > 0 {
+			namespaces, err := syncer.NamespacesForSelectors(fi.KubeClient, opt.NamespaceSelectors)
 			Expect(err).NotTo(HaveOccurred())
 
 			for _, ns := range namespaces.List() {
@@ -130,8 +130,8 @@ func (fi *Invocation) EventuallySyncedSecretsUpdated(source *core.Secret) Gomega
 	opt := syncer.GetSyncOptions(source.Annotations)
 
 	return Eventually(func() bool {
-		if opt.NamespaceSelector != nil {
-			namespaces, err := syncer.NamespacesForSelector(fi.KubeClient, *opt.NamespaceSelector)
+		if len(opt.NamespaceSelectors) > 0 {
+			namespaces, err := syncer.NamespacesForSelectors(fi.KubeClient, opt.NamespaceSelectors)
 			Expect(err).NotTo(HaveOccurred())
 
 			for _, ns := range namespaces.List() {
@@ -156,8 +156,8 @@ func (fi *Invocation) EventuallySyncedSecretsDeleted(source *core.Secret) Gomega
 	opt := syncer.GetSyncOptions(source.Annotations)
 
 	return Eventually(func() bool {
-		if opt.NamespaceSelector != nil {
-			namespaces, err := syncer.NamespacesForSelector(fi.KubeClient, *opt.NamespaceSelector)
+		if len(opt.NamespaceSelectors) > 0 {
+			namespaces, err := syncer.NamespacesForSelectors(fi.KubeClient, opt.NamespaceSelectors)
 			Expect(err).NotTo(HaveOccurred())
 
 			for _, ns := range namespaces.List() {